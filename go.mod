@@ -3,9 +3,11 @@ module github.com/alex-parra/gotestiful
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/fatih/color v1.13.0
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/exp v0.0.0-20230111222715-75897c7a292a
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -14,5 +16,4 @@ require (
 	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.1.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -9,10 +9,17 @@
 
 	`gotestiful init`
 	- creates a base configuration in the current folder (the config file is optional. you may opt to use flags only)
+	- it inspects the module packages and asks to exclude generated code, mocks and main packages without tests, -yes accepts all suggestions
 
 	`gotestiful help`
 	- shows examples and flags infos
 
+	`gotestiful config`
+	- shows the resolved settings and where each one comes from (default, global or project file, profile, env or flag)
+
+	`gotestiful config migrate`
+	- upgrades the project and global config files to the current format version
+
 	`gotestiful`
 	- runs tests for the current folder eg. `go test ./...`
 
@@ -27,16 +34,89 @@
 # Features:
 
 	config file per project [optional]
-	- run `gotestiful init` from your project root to create a `.gotestiful` config file and then adjust the settings. afterwards you only need to run `gotestiful` and the config is read
+	- run `gotestiful init` from your project root to create a `.gotestiful` config file and then adjust the settings. afterwards you only need to run `gotestiful` and the config is read.
+	  run `gotestiful init -format yaml` (or `toml`) for a `.gotestiful.yaml` (or `.gotestiful.toml`) file, which allow comments.
+	  the config is searched up to the module root (go.mod or go.work folder)
+
+	global config
+	- personal preferences go in `$XDG_CONFIG_HOME/gotestiful/config`. precedence: defaults, global config, project config, profile, environment, flags
+
+	config profiles
+	- add named partial configs to the config `profiles` map eg. `ci` and select one with `-profile ci` or GOTESTIFUL_PROFILE
+
+	environment variables
+	- every config key can be set with a GOTESTIFUL_* variable eg. GOTESTIFUL_COVERAGE_ENABLED=false, GOTESTIFUL_EXCLUDE=a,b or GOTESTIFUL_AZURE_COMMENT=true
+
+	config versions
+	- the config `version` key is its format version, version 2 groups the output settings in `output` and the coverage ones in `coverage`
+	- older configs load with a deprecation warning, `gotestiful config migrate` upgrades the config files in place (TOML files with comments: prints the migrated content instead)
+
+	config JSON Schema
+	- gotestiful.schema.json describes every config key so editors autocomplete and validate the config, `gotestiful init` references it
+	- `gotestiful schema` prints it, generated from the config types with the flags help
 
 	exclusion list
 	- add packages (or just prefixes) to the config `exclude` array to not test those packages eg. exclude generated code such as protobuf packages
+	- set the `include` array to only test the packages it matches, `exclude` then applies to them
+	- entries are import path regexes, globs with ** or a glob: prefix eg. mod/gen/** or directories relative to the module root eg. ./internal/gen/...
+	- a ! prefix negates an entry (the last matching one wins) and -listignored shows the rule that excluded each package
+
+	per-package settings
+	- the config `packages` map sets go test options for the packages matching each key (an include/exclude pattern): timeout, tags, env, args, a minimum coverage and cache
+	- packages with the same settings are tested by one go test run, the runs go concurrently into one summary
 
 	global coverage summary
 	- shows the overall code coverage calculated from the coverage score of each tested package.
 
 	open html coverage detail report
 	- set the `-report` flag and the coverage html detail will open (eg. `go tool cover -html`)
+
+	junit report
+	- set the `-junit` flag to a file path to write a JUnit XML report that CI systems can read
+
+	json summary
+	- set the `-summary-json` flag to a file path to write the packages, tests and coverage results as JSON for scripts
+
+	custom output templates
+	- set the `-template` flag to a Go text/template file rendered over the json summary model eg. for chat messages or changelogs.
+	  set `-comment-template` to customize the pull request comment body
+
+	coverage delta
+	- set `-baseline` to a `-summary-json` file of the target branch to show the per package coverage changes in the pull request comments
+
+	webhook notifications
+	- add endpoints to the config `notify` list to post a templated JSON body eg. to Slack, Teams or Mattermost, always or on failure / coverage drop
+
+	github actions
+	- when run in GitHub Actions failed tests are annotated, tests output is grouped and a job summary is written
+
+	github pull requests
+	- set the `-githubComment` flag to publish the coverage and failed tests as a pull request comment, updated on each run.
+	  set `inlineComments` and `status` in the config `github` section to also comment each test failure line and set a commit status
+
+	azure pipelines
+	- when run in Azure Pipelines failed tests are logged as issues, coverage and failures are exported as variables and JUnit and Cobertura reports are published
+
+	azure devops pull request comment
+	- set the `-azureComment` flag to publish the coverage and failed tests as a pull request thread, updated on each run (active on failure, fixed on success).
+	  the threads url and token are read from the Azure Pipelines variables (SYSTEM_ACCESSTOKEN for the token).
+	  set `-azureInlineComments` to also open a thread at the file line of each test failure
+
+	bitbucket and gitea pull requests
+	- set `comment`, `inlineComments` and `status` in the config `bitbucket` or `gitea` section to publish the summary comment,
+	  a comment at each test failure line and a commit status
+
+	publisher selection
+	- the pull request publishing of the provider detected from the CI variables (GitHub, GitLab, Azure DevOps, Bitbucket or Gitea) is used,
+	  set the config `publish.provider` or `-publisher` to choose it
+
+	publishing settings
+	- the PR comments and webhooks time out and retry (config `publish` section). set `-publish-dry-run` to print the requests instead of sending them
+
+	gitlab ci
+	- when run in GitLab CI the total coverage is printed for the coverage regex and JUnit and Cobertura reports are written.
+	  set the `-gitlabNote` flag to publish the coverage and failed tests as a merge request note, updated on each run.
+	  set `inlineComments` and `status` in the config `gitlab` section to also open a discussion at each test failure line and set a commit status
 */
 package main
 
@@ -52,47 +132,142 @@ import (
 const version = "v1.1.2"
 
 func main() {
-	conf, err := gtf.GetConfig()
+	profile := gtf.ProfileFromArgs(os.Args[1:])
+	conf, err := gtf.GetConfig(profile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	flag.String("profile", profile, "Config profile: apply the named config 'profiles' entry over the config eg. -profile ci (default GOTESTIFUL_PROFILE)")
+
 	flagVersion := flag.Bool("version", false, "Gotestiful version: print version information")
-	flagColor := flag.Bool("color", conf.Color, "Colorize output: turn colorized output on/off")
+	flagColor := flag.Bool("color", conf.Output.Color, "Colorize output: turn colorized output on/off")
 	flagCache := flag.Bool("cache", conf.Cache, "Test caching: tests cache on/off eg. 'go test -count=1' if false")
-	flagCover := flag.Bool("cover", conf.Cover, "Coverage: turn coverage reporting on/off eg. 'go test -cover'")
-	flagCoverReport := flag.Bool("report", conf.Report, "Coverage details: open html coverage report eg. 'go tool cover -html'")
-	flagCoverProfile := flag.String("coverprofile", conf.CoverProfile, "Coverage profile: coverage report output file path (default ./coverage.out). Takes longer (disables caching).")
-	flagVerbose := flag.Bool("v", conf.Verbose, "Verbose output: run tests with verbose output eg. 'go test -v'")
-	flagListIgnored := flag.Bool("listignored", conf.ListIgnored, "Excluded packages: list ignored packages (at the end)")
-	flagSkipEmpty := flag.Bool("skipempty", conf.SkipEmpty, "No tests omit: do not show packages with no tests in the output (affects coverage)")
-	flagListEmpty := flag.Bool("listempty", conf.ListEmpty, "No tests list: list packages with no tests (at the end)")
-	flagFullCoverage := flag.Bool("fullCoverage", conf.FullCoverage, "Count overall coverage including packages without tests. Takes longer (disables caching).")
+	flagCover := flag.Bool("cover", conf.Coverage.Enabled, "Coverage: turn coverage reporting on/off eg. 'go test -cover'")
+	flagCoverReport := flag.Bool("report", conf.Coverage.Report, "Coverage details: open html coverage report eg. 'go tool cover -html'")
+	flagCoverProfile := flag.String("coverprofile", conf.Coverage.Profile, "Coverage profile: coverage report output file path (default ./coverage.out). Takes longer (disables caching).")
+	flagVerbose := flag.Bool("v", conf.Output.Verbose, "Verbose output: run tests with verbose output eg. 'go test -v'")
+	flagListIgnored := flag.Bool("listignored", conf.Output.ListIgnored, "Excluded packages: list ignored packages (at the end)")
+	flagSkipEmpty := flag.Bool("skipempty", conf.Output.SkipEmpty, "No tests omit: do not show packages with no tests in the output (affects coverage)")
+	flagListEmpty := flag.Bool("listempty", conf.Output.ListEmpty, "No tests list: list packages with no tests (at the end)")
+	flagFullCoverage := flag.Bool("fullCoverage", conf.Coverage.Full, "Count overall coverage including packages without tests. Takes longer (disables caching).")
 	flagTestOutput := flag.String("testoutput", conf.TestOutput, "Print JSON output of go test to the given file. Output format is same as go test with -json flag")
+	flagJUnit := flag.String("junit", conf.JUnit, "JUnit report: write a JUnit XML report of the test results to the given file")
+	flagSummaryJSON := flag.String("summary-json", conf.SummaryJSON, "JSON summary: write a machine readable summary of the run (packages, tests, coverage) to the given file")
+	flagCobertura := flag.String("cobertura", conf.Cobertura, "Cobertura report: write a Cobertura XML coverage report to the given file. Takes longer (disables caching).")
+	flagTemplate := flag.String("template", conf.Template, "Template: render the run summary with the given Go text/template file")
+	flagTemplateOut := flag.String("template-output", conf.TemplateOutput, "Template output: write the rendered -template to the given file instead of printing it")
+	flagCommentTemplate := flag.String("comment-template", conf.CommentTemplate, "Comment template: Go text/template file for the pull request comment body")
+	flagBaseline := flag.String("baseline", conf.Baseline, "Baseline: a previous -summary-json file (eg. of the target branch) to compare the coverage against")
+
+	azure := gtf.AzureConfFromEnv(conf.Azure)
+	flagAzureComment := flag.Bool("azureComment", azure.Comment, "Azure DevOps PR comment: publish coverage and failed tests as a pull request thread (uses SYSTEM_COLLECTIONURI, SYSTEM_TEAMPROJECT, BUILD_REPOSITORY_ID, SYSTEM_PULLREQUEST_PULLREQUESTID and SYSTEM_ACCESSTOKEN)")
+	flagAzureInlineComments := flag.Bool("azureInlineComments", azure.InlineComments, "Azure DevOps inline PR comments: publish a pull request thread at the file line of each test failure")
+	flagAzureDevopsURL := flag.String("azureDevopsURL", "", "Azure DevOps PR comment: pull request threads url, enables -azureComment (default derived from the pipeline variables)")
+	flagAzureDevopsAuthToken := flag.String("azureDevopsAuthToken", "", "Azure DevOps PR comment: auth token. Deprecated: it shows in logs, set SYSTEM_ACCESSTOKEN instead")
+
+	github := gtf.GitHubConfFromEnv(conf.GitHub)
+	flagGitHubComment := flag.Bool("githubComment", github.Comment, "GitHub PR comment: publish coverage and failed tests as a pull request comment (uses GITHUB_REPOSITORY, GITHUB_REF and GITHUB_TOKEN)")
+	flagGitHubAPIURL := flag.String("githubAPIURL", github.APIURL, "GitHub API url: REST API base url eg. for GitHub Enterprise (default GITHUB_API_URL)")
+
+	gitlab := gtf.GitLabConfFromEnv(conf.GitLab)
+	flagGitLabNote := flag.Bool("gitlabNote", gitlab.Comment, "GitLab MR note: publish coverage and failed tests as a merge request note (uses CI_API_V4_URL, CI_PROJECT_ID, CI_MERGE_REQUEST_IID and GITLAB_TOKEN)")
 
-	flagAzureDevopsURL := flag.String("azureDevopsURL", "", "Add azure devops URL to send a request with comment to")
-	flagAzureDevopsAuthToken := flag.String("azureDevopsAuthToken", "", "Add azure devops auth token to send a request with comment to")
+	bitbucket := gtf.BitbucketConfFromEnv(conf.Bitbucket)
+	gitea := gtf.GiteaConfFromEnv(conf.Gitea)
+
+	publish := conf.Publish
+	flagPublisher := flag.String("publisher", publish.Provider, "Publisher: code review provider of the PR comments: azure, bitbucket, gitea, github or gitlab (default detected from the CI variables)")
+	flagPublishDryRun := flag.Bool("publish-dry-run", false, "Publish dry-run: print the pull request comments and webhook requests instead of sending them")
 
 	flag.Usage = gtf.PrintHelp
 	flag.Parse()
 
+	github.Comment = *flagGitHubComment
+	github.APIURL = *flagGitHubAPIURL
+	gitlab.Comment = *flagGitLabNote
+	publish.DryRun = *flagPublishDryRun
+	publish.Provider = *flagPublisher
+	azure.Comment = *flagAzureComment
+	azure.InlineComments = *flagAzureInlineComments
+	if *flagAzureDevopsURL != "" {
+		azure.Comment = true
+		azure.URL = *flagAzureDevopsURL
+	}
+	if *flagAzureDevopsAuthToken != "" {
+		gtf.WarnDeprecatedFlag("azureDevopsAuthToken", "the token shows in logs, set SYSTEM_ACCESSTOKEN instead")
+		azure.Auth = *flagAzureDevopsAuthToken
+	}
+
 	testPath := flag.Arg(0)
 	if testPath == "" {
 		testPath = "./..."
 	}
 
+	flags := map[string]string{}
+	flag.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+	// the PR comments are skipped without the pull request details, unless the provider is chosen in the command line.
+	// the -githubComment, -gitlabNote and -azure* flags choose their provider, as they published anywhere before it was selected.
+	_, flagPublisherSet := flags["publisher"]
+	_, flagGitHubCommentSet := flags["githubComment"]
+	_, flagGitLabNoteSet := flags["gitlabNote"]
+	_, flagAzureCommentSet := flags["azureComment"]
+	_, flagAzureInlineCommentsSet := flags["azureInlineComments"]
+	flagAzureSet := *flagAzureDevopsURL != "" || (flagAzureCommentSet && *flagAzureComment) || (flagAzureInlineCommentsSet && *flagAzureInlineComments)
+	switch {
+	case flagPublisherSet:
+	case flagGitHubCommentSet && *flagGitHubComment:
+		publish.Provider = "github"
+	case flagGitLabNoteSet && *flagGitLabNote:
+		publish.Provider = "gitlab"
+	case flagAzureSet:
+		publish.Provider = "azure"
+	}
+	publish.Required = flagPublisherSet || flagGitHubCommentSet || flagGitLabNoteSet || flagAzureSet
+
 	switch {
 	case *flagVersion:
 		gtf.PrintVersion(version)
 
+	case testPath == "config" && flag.Arg(1) == "migrate":
+		err := gtf.MigrateConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case testPath == "config":
+		err := gtf.ShowConfig(profile, flags)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case testPath == "schema":
+		flagUsage := map[string]string{}
+		flag.VisitAll(func(f *flag.Flag) { flagUsage[f.Name] = f.Usage })
+
+		err := gtf.PrintSchema(flagUsage)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 	case testPath == "init":
-		err := gtf.InitConfig()
+		initFlags := flag.NewFlagSet("init", flag.ExitOnError)
+		flagFormat := initFlags.String("format", "json", "Config format: json (.gotestiful), yaml (.gotestiful.yaml) or toml (.gotestiful.toml)")
+		flagYes := initFlags.Bool("yes", false, "Accept the suggested excludes and settings without asking")
+		_ = initFlags.Parse(flag.Args()[1:])
+
+		err := gtf.InitConfig(*flagFormat, *flagYes)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 	default:
-		err := gtf.RunTests(gtf.RunTestsOpts{
+		err := gtf.ValidateConfig(profile, flags)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = gtf.RunTests(gtf.RunTestsOpts{
 			TestPath:         testPath,
 			FlagColor:        *flagColor,
 			FlagCache:        *flagCache,
@@ -104,13 +279,26 @@ func main() {
 			FlagSkipEmpty:    *flagSkipEmpty,
 			FlagListEmpty:    *flagListEmpty,
 			FlagFullCoverage: *flagFullCoverage,
+			Includes:         conf.Include,
 			Excludes:         conf.Exclude,
+			Packages:         conf.Packages,
 			FlagTestOutput:   *flagTestOutput,
+			FlagJUnit:        *flagJUnit,
+			FlagCobertura:    *flagCobertura,
+			FlagSummaryJSON:  *flagSummaryJSON,
+			FlagTemplate:     *flagTemplate,
+			FlagTemplateOut:  *flagTemplateOut,
+			CommentTemplate:  *flagCommentTemplate,
+			FlagBaseline:     *flagBaseline,
+			Notify:           conf.Notify,
+			Publish:          publish,
+			Version:          version,
 
-			Azure: gtf.AzureConf{
-				URL:  *flagAzureDevopsURL,
-				Auth: *flagAzureDevopsAuthToken,
-			},
+			Azure:     azure,
+			Bitbucket: bitbucket,
+			Gitea:     gitea,
+			GitHub:    github,
+			GitLab:    gitlab,
 		})
 
 		switch {
@@ -1,75 +1,385 @@
 package internal
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Azure DevOps pull request thread statuses
+const (
+	azureThreadActive = 1
+	azureThreadFixed  = 2
 )
 
 type AzureBody struct {
-	Status   int            `json:"status"`
-	Comments []AzureComment `json:"comments"`
+	Status        int                 `json:"status"`
+	Comments      []AzureComment      `json:"comments,omitempty"`
+	ThreadContext *AzureThreadContext `json:"threadContext,omitempty"`
+}
+
+// AzureThreadContext positions a thread at a file line of the pull request diff
+type AzureThreadContext struct {
+	FilePath       string            `json:"filePath"` // repository path eg. /pkg/a_test.go
+	RightFileStart AzureFilePosition `json:"rightFileStart"`
+	RightFileEnd   AzureFilePosition `json:"rightFileEnd"`
+}
+
+type AzureFilePosition struct {
+	Line   int `json:"line"`
+	Offset int `json:"offset"`
 }
 
 type AzureComment struct {
+	ID              int    `json:"id,omitempty"`
 	ParentCommentID int    `json:"parentCommentId"`
 	Content         string `json:"content"`
 	CommentType     int    `json:"commentType"`
 }
 
+// azureThreads is the response of the pull request threads list
+type azureThreads struct {
+	Value []struct {
+		ID            int                 `json:"id"`
+		Comments      []AzureComment      `json:"comments"`
+		ThreadContext *AzureThreadContext `json:"threadContext"`
+	} `json:"value"`
+}
+
+const azureAPIVersion = "7.0"
+
+// AzureConf holds the Azure DevOps pull request comment settings, set in the config 'azure' section.
 type AzureConf struct {
-	URL, Auth string
+	PublishFeatures
+	URL  string `json:"url"` // pull request threads endpoint, derived from the pipeline variables if empty
+	Auth string `json:"-"`   // SYSTEM_ACCESSTOKEN
+
+	Pipelines  bool   `json:"-"` // running in Azure Pipelines (logging commands and test results publishing)
+	SourcesDir string `json:"-"` // repository root, issue paths are relative to it
+
+	Publish PublishConf `json:"-"`
 }
 
-func makeComment(coverage float64, badTests []string) string {
-	coverageComment := "Total coverage is " + sf("%.2f", coverage) + "%"
-	testComment := "All tests are successful. 💪\n\n"
+// AzureConfFromEnv completes the 'conf' settings with the Azure Pipelines predefined variables
+func AzureConfFromEnv(conf AzureConf) AzureConf {
+	conf.URL = zvfb(conf.URL, azureThreadsURL(
+		os.Getenv("SYSTEM_COLLECTIONURI"),
+		os.Getenv("SYSTEM_TEAMPROJECT"),
+		os.Getenv("BUILD_REPOSITORY_ID"),
+		os.Getenv("SYSTEM_PULLREQUEST_PULLREQUESTID"),
+	))
+	conf.Auth = os.Getenv("SYSTEM_ACCESSTOKEN")
+	conf.Pipelines = os.Getenv("TF_BUILD") == "True"
+	conf.SourcesDir = os.Getenv("BUILD_SOURCESDIRECTORY")
+	return conf
+}
 
-	if len(badTests) != 0 {
-		testComment = "Test failed. 🙅 \n\n Failed tests:\n\n"
-		testComment += "|Test name|\n|--------|\n"
-		for _, t := range badTests {
-			testComment += "|" + t + "|\n"
-		}
-		testComment += "\n"
+// azureThreadsURL builds the pull request threads endpoint eg.
+// https://dev.azure.com/{org}/{project}/_apis/git/repositories/{repo}/pullRequests/{id}/threads?api-version=7.0
+func azureThreadsURL(collectionURI, project, repositoryID, pullRequestID string) string {
+	if collectionURI == "" || project == "" || repositoryID == "" || pullRequestID == "" {
+		return ""
 	}
 
-	return testComment + coverageComment
+	return sf("%s/%s/_apis/git/repositories/%s/pullRequests/%s/threads?api-version=%s",
+		strings.TrimRight(collectionURI, "/"), url.PathEscape(project), url.PathEscape(repositoryID), url.PathEscape(pullRequestID), azureAPIVersion)
 }
 
-func (az AzureConf) sendAzureComment(coverage float64, failedTests []string) error {
-	if az.URL == "" {
+// failureMarker identifies the inline failure threads created by gotestiful so they can be updated and resolved
+const failureMarker = "<!-- gotestiful:failure -->"
+
+// commentMarker identifies the pull request comments created by gotestiful so they can be updated
+const commentMarker = "<!-- gotestiful:coverage -->"
+
+// azureReporter emits the Azure Pipelines logging commands. The pull request threads are published by the publishReporter.
+type azureReporter struct {
+	nopReporter
+	conf          AzureConf
+	pkgsMap       map[string]Package
+	junitFile     string
+	coberturaFile string
+	lineOut       func(str ...string)
+}
+
+func (r azureReporter) OnSummary(result RunResult) error {
+	if !r.conf.Pipelines {
 		return nil
 	}
 
-	dat, err := json.Marshal(AzureBody{
-		Status: 2,
-		Comments: []AzureComment{{
-			ParentCommentID: 0,
-			CommentType:     1,
-			Content:         makeComment(coverage, failedTests),
-		}},
-	})
+	for _, l := range r.conf.logIssues(result, r.pkgsMap) {
+		r.lineOut(l)
+	}
+	r.lineOut(azureCommand("task.setvariable", map[string]string{"variable": "gotestifulCoverage"}, sf("%.2f", result.TotalCoverage)))
+	r.lineOut(azureCommand("task.setvariable", map[string]string{"variable": "gotestifulFailedTests"}, sf("%d", len(result.FailedTests))))
+
+	publish, err := r.conf.publishCommands(r.junitFile, r.coberturaFile)
+	if err != nil {
+		return err
+	}
+	for _, l := range publish {
+		r.lineOut(l)
+	}
+
+	return nil
+}
+
+// logIssues returns '##vso[task.logissue]' commands for each failed test location
+func (az AzureConf) logIssues(result RunResult, pkgsMap map[string]Package) []string {
+	lines := []string{}
+
+	for _, test := range result.Tests {
+		if test.Status != "fail" {
+			continue
+		}
+
+		title := test.Package + "." + test.Name
+		locations := failureLocations(test.Output)
+
+		if len(locations) == 0 {
+			// eg. panics or a parent test failing because of its subtests
+			if test.isPanic() {
+				lines = append(lines, azureCommand("task.logissue", map[string]string{"type": "error"}, title+": "+strings.Join(test.Output, "\n")))
+			}
+			continue
+		}
+
+		for _, loc := range locations {
+			props := map[string]string{
+				"type":       "error",
+				"sourcepath": relPath(az.SourcesDir, pkgsMap[test.Package].Dir, loc.File),
+				"linenumber": strconv.Itoa(loc.Line),
+			}
+			lines = append(lines, azureCommand("task.logissue", props, title+": "+zvfb(loc.Message, "test failed")))
+		}
+	}
+
+	return lines
+}
+
+// publishCommands returns the commands publishing the JUnit results and Cobertura coverage to the Tests and Coverage tabs
+func (az AzureConf) publishCommands(junitFile, coberturaFile string) ([]string, error) {
+	lines := []string{}
+
+	if junitFile != "" {
+		abs, err := filepath.Abs(junitFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish test results: %w", err)
+		}
+		props := map[string]string{"type": "JUnit", "runTitle": "gotestiful", "resultFiles": abs}
+		lines = append(lines, azureCommand("results.publish", props, ""))
+	}
+
+	if coberturaFile != "" {
+		abs, err := filepath.Abs(coberturaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish code coverage: %w", err)
+		}
+		props := map[string]string{"codecoveragetool": "Cobertura", "summaryfile": abs}
+		lines = append(lines, azureCommand("codecoverage.publish", props, ""))
+	}
+
+	return lines, nil
+}
+
+// azureCommand formats a logging command eg. '##vso[task.logissue type=error;sourcepath=a_test.go;linenumber=1;]message'
+func azureCommand(command string, props map[string]string, message string) string {
+	cmd := "##vso[" + command
+
+	propsList := []string{}
+	for _, key := range mapSortedKeys(props) {
+		propsList = append(propsList, key+"="+azureEscape(props[key], true))
+	}
+	if len(propsList) > 0 {
+		cmd += " " + strings.Join(propsList, ";") + ";"
+	}
+
+	return cmd + "]" + azureEscape(message, false)
+}
+
+func azureEscape(str string, property bool) string {
+	replacer := strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A")
+	if property {
+		replacer = strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A", ";", "%3B", "]", "%5D")
+	}
+	return replacer.Replace(str)
+}
+
+func (az AzureConf) Features() PublishFeatures {
+	return az.PublishFeatures
+}
+
+// PublishComment posts the summary as a pull request thread, active if 'failed' else fixed
+func (az AzureConf) PublishComment(body string, failed bool) error {
+	content := commentMarker + "\n" + body
+	status := ifelse(failed, azureThreadActive, azureThreadFixed)
+
+	threadID, commentID, err := az.findThread()
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, az.URL, bytes.NewReader(dat))
+	if threadID == 0 {
+		return az.request(http.MethodPost, az.URL, AzureBody{
+			Status: status,
+			Comments: []AzureComment{{
+				ParentCommentID: 0,
+				CommentType:     1,
+				Content:         content,
+			}},
+		}, nil)
+	}
+
+	err = az.request(http.MethodPatch, az.threadURL(threadID, sf("comments/%d", commentID)), AzureComment{Content: content}, nil)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+az.Auth)
-	req.Header.Set("Content-Type", "application/json")
+	return az.request(http.MethodPatch, az.threadURL(threadID, ""), AzureBody{Status: status}, nil)
+}
+
+// PublishAnnotations publishes a thread at the '_test.go' line of each failure. The threads of a previous run
+// are updated if the line still fails, else resolved as fixed.
+func (az AzureConf) PublishAnnotations(annotations []Annotation) error {
+	failures := az.inlineFailures(annotations)
 
-	resp, err := http.DefaultClient.Do(req)
+	var threads azureThreads
+	err := az.request(http.MethodGet, az.URL, nil, &threads)
 	if err != nil {
-		fmt.Printf("Error: %+v", err)
 		return err
 	}
 
-	defer resp.Body.Close()
+	for _, t := range threads.Value {
+		if t.ThreadContext == nil || len(t.Comments) == 0 || !strings.Contains(t.Comments[0].Content, failureMarker) {
+			continue
+		}
+
+		key := sf("%s:%d", t.ThreadContext.FilePath, t.ThreadContext.RightFileStart.Line)
+		content, failing := failures[key]
+		if !failing {
+			err = az.request(http.MethodPatch, az.threadURL(t.ID, ""), AzureBody{Status: azureThreadFixed}, nil)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = az.request(http.MethodPatch, az.threadURL(t.ID, sf("comments/%d", t.Comments[0].ID)), AzureComment{Content: content}, nil)
+		if err != nil {
+			return err
+		}
+		err = az.request(http.MethodPatch, az.threadURL(t.ID, ""), AzureBody{Status: azureThreadActive}, nil)
+		if err != nil {
+			return err
+		}
+		delete(failures, key)
+	}
+
+	// a failing thread eg. at a line outside the diff does not stop the others
+	errs := []error{}
+	for _, key := range mapSortedKeys(failures) {
+		sep := strings.LastIndex(key, ":")
+		line, _ := strconv.Atoi(key[sep+1:])
+		position := AzureFilePosition{Line: line, Offset: 1}
+
+		err = az.request(http.MethodPost, az.URL, AzureBody{
+			Status:        azureThreadActive,
+			Comments:      []AzureComment{{ParentCommentID: 0, CommentType: 1, Content: failures[key]}},
+			ThreadContext: &AzureThreadContext{FilePath: key[:sep], RightFileStart: position, RightFileEnd: position},
+		}, nil)
+		errs = append(errs, err)
+	}
+
+	return joinErrors(errs)
+}
+
+// inlineFailures returns the inline thread content of each annotation, keyed by '/repo/path_test.go:line'
+func (az AzureConf) inlineFailures(annotations []Annotation) map[string]string {
+	failures := map[string]string{}
+	for _, a := range annotations {
+		failures[sf("/%s:%d", relPath(az.SourcesDir, "", a.File), a.Line)] = failureMarker + "\n" + a.Body
+	}
+	return failures
+}
+
+// azureStatus is a pull request status, shown in the pull request checks
+type azureStatus struct {
+	State       string `json:"state"` // succeeded or failed
+	Description string `json:"description"`
+	Context     struct {
+		Name  string `json:"name"`
+		Genre string `json:"genre"`
+	} `json:"context"`
+}
 
+// PublishStatus posts a pull request status. Azure DevOps shows the latest status of each context.
+func (az AzureConf) PublishStatus(failed bool, description string) error {
+	status := azureStatus{State: ifelse(failed, "failed", "succeeded"), Description: description}
+	status.Context.Name = "tests"
+	status.Context.Genre = "gotestiful"
+
+	return az.request(http.MethodPost, az.statusesURL(), status, nil)
+}
+
+func (az AzureConf) Ready() error {
+	if az.URL == "" || az.Auth == "" {
+		return fmt.Errorf("azure comment: threads url and token are required (SYSTEM_COLLECTIONURI, SYSTEM_TEAMPROJECT, BUILD_REPOSITORY_ID, SYSTEM_PULLREQUEST_PULLREQUESTID, SYSTEM_ACCESSTOKEN)")
+	}
 	return nil
 }
+
+// findThread looks for the thread (and its comment) created by gotestiful in the pull request threads
+func (az AzureConf) findThread() (threadID, commentID int, err error) {
+	var threads azureThreads
+	err = az.request(http.MethodGet, az.URL, nil, &threads)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, t := range threads.Value {
+		for _, c := range t.Comments {
+			if strings.Contains(c.Content, commentMarker) {
+				return t.ID, c.ID, nil
+			}
+		}
+	}
+
+	return 0, 0, nil
+}
+
+// threadURL returns the url of a thread (or its 'subPath') keeping the threads url query eg. api-version
+func (az AzureConf) threadURL(threadID int, subPath string) string {
+	u, err := url.Parse(az.URL)
+	if err != nil {
+		return az.URL
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/") + sf("/%d", threadID)
+	if subPath != "" {
+		u.Path += "/" + subPath
+	}
+
+	return u.String()
+}
+
+// statusesURL returns the pull request statuses url, a sibling of the threads url
+func (az AzureConf) statusesURL() string {
+	u, err := url.Parse(az.URL)
+	if err != nil {
+		return az.URL
+	}
+
+	u.Path = strings.TrimSuffix(strings.TrimRight(u.Path, "/"), "/threads") + "/statuses"
+	return u.String()
+}
+
+func (az AzureConf) request(method, reqURL string, body, out any) error {
+	return apiClient{
+		name:    "azure comment",
+		headers: map[string]string{"Authorization": "Bearer " + az.Auth},
+		conf:    az.Publish,
+	}.request(method, reqURL, body, out)
+}
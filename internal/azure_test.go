@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureThreadURL(t *testing.T) {
+	az := AzureConf{URL: "https://dev.azure.com/org/proj/_apis/git/repositories/repo/pullRequests/5/threads?api-version=7.0"}
+	assert.Equal(t, "https://dev.azure.com/org/proj/_apis/git/repositories/repo/pullRequests/5/threads/12?api-version=7.0", az.threadURL(12, ""))
+	assert.Equal(t, "https://dev.azure.com/org/proj/_apis/git/repositories/repo/pullRequests/5/threads/12/comments/1?api-version=7.0", az.threadURL(12, "comments/1"))
+}
+
+func TestAzureConfFromEnv(t *testing.T) {
+	t.Setenv("SYSTEM_COLLECTIONURI", "https://dev.azure.com/org/")
+	t.Setenv("SYSTEM_TEAMPROJECT", "My Project")
+	t.Setenv("BUILD_REPOSITORY_ID", "1234-abcd")
+	t.Setenv("SYSTEM_PULLREQUEST_PULLREQUESTID", "42")
+	t.Setenv("SYSTEM_ACCESSTOKEN", "tkn")
+	t.Setenv("TF_BUILD", "True")
+	t.Setenv("BUILD_SOURCESDIRECTORY", "/agent/s")
+
+	az := AzureConfFromEnv(AzureConf{PublishFeatures: PublishFeatures{Comment: true}})
+	assert.Equal(t, AzureConf{
+		PublishFeatures: PublishFeatures{Comment: true},
+		URL:             "https://dev.azure.com/org/My%20Project/_apis/git/repositories/1234-abcd/pullRequests/42/threads?api-version=7.0",
+		Auth:            "tkn",
+		Pipelines:       true,
+		SourcesDir:      "/agent/s",
+	}, az)
+
+	t.Setenv("TF_BUILD", "")
+	t.Setenv("BUILD_SOURCESDIRECTORY", "")
+
+	az = AzureConfFromEnv(AzureConf{URL: "https://azure.example.com/threads", Auth: "from-file"})
+	assert.Equal(t, AzureConf{URL: "https://azure.example.com/threads", Auth: "tkn"}, az)
+
+	t.Setenv("SYSTEM_PULLREQUEST_PULLREQUESTID", "")
+	assert.Equal(t, "", AzureConfFromEnv(AzureConf{}).URL)
+}
+
+func TestAzureCommand(t *testing.T) {
+	assert.Equal(t, "##vso[task.setvariable variable=cov;]71.30", azureCommand("task.setvariable", map[string]string{"variable": "cov"}, "71.30"))
+	assert.Equal(t,
+		"##vso[task.logissue linenumber=3;sourcepath=a%3Bb%5D_test.go;type=error;]100%AZP25%0Agot 1",
+		azureCommand("task.logissue", map[string]string{"type": "error", "sourcepath": "a;b]_test.go", "linenumber": "3"}, "100%\ngot 1"),
+	)
+}
+
+func TestAzureLogIssues(t *testing.T) {
+	az := AzureConf{SourcesDir: "/src"}
+	pkgsMap := map[string]Package{"mod/pkg": {Dir: "/src/pkg"}}
+	result := RunResult{
+		Tests: []TestResult{
+			{Package: "mod/pkg", Name: "TestGood", Status: "pass"},
+			{Package: "mod/pkg", Name: "TestBad", Status: "fail", Output: []string{"    pkg_test.go:12: want 1", "        got 2"}},
+			{Package: "mod/pkg", Name: "TestPanic", Status: "fail", Output: []string{"panic: boom"}},
+			{Package: "mod/pkg", Name: "TestParent", Status: "fail"},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"##vso[task.logissue linenumber=12;sourcepath=pkg/pkg_test.go;type=error;]mod/pkg.TestBad: want 1%0Agot 2",
+		"##vso[task.logissue type=error;]mod/pkg.TestPanic: panic: boom",
+	}, az.logIssues(result, pkgsMap))
+}
+
+func TestAzurePublishCommands(t *testing.T) {
+	lines, err := AzureConf{}.publishCommands("", "")
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+
+	lines, err = AzureConf{}.publishCommands("/out/junit.xml", "/out/cobertura.xml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"##vso[results.publish resultFiles=/out/junit.xml;runTitle=gotestiful;type=JUnit;]",
+		"##vso[codecoverage.publish codecoveragetool=Cobertura;summaryfile=/out/cobertura.xml;]",
+	}, lines)
+}
+
+func TestAzurePublishComment(t *testing.T) {
+	type request struct {
+		Method, Path, Auth, Body string
+	}
+
+	stub := func(threads string) (*httptest.Server, *[]request) {
+		requests := []request{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests = append(requests, request{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(body)})
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(threads))
+			}
+		}))
+		return server, &requests
+	}
+
+	content, _ := json.Marshal(commentMarker + "\nTotal coverage is 75.00%")
+
+	t.Run("missing settings", func(t *testing.T) {
+		assert.Error(t, AzureConf{URL: "http://localhost"}.Ready())
+	})
+
+	t.Run("creates thread", func(t *testing.T) {
+		server, requests := stub(`{"value": [{"id": 3, "comments": [{"id": 1, "content": "someone else"}]}], "count": 1}`)
+		defer server.Close()
+
+		az := AzureConf{URL: server.URL + "/threads?api-version=7.0", Auth: "tkn"}
+		assert.NoError(t, az.PublishComment("Total coverage is 75.00%", true))
+		assert.Equal(t, []request{
+			{http.MethodGet, "/threads?api-version=7.0", "Bearer tkn", ""},
+			{http.MethodPost, "/threads?api-version=7.0", "Bearer tkn", `{"status":1,"comments":[{"parentCommentId":0,"content":` + string(content) + `,"commentType":1}]}`},
+		}, *requests)
+	})
+
+	t.Run("updates own thread", func(t *testing.T) {
+		server, requests := stub(`{"value": [{"id": 3, "comments": [{"id": 1, "content": "someone else"}]}, {"id": 8, "comments": [{"id": 1, "content": "` + commentMarker + `\nold"}]}]}`)
+		defer server.Close()
+
+		az := AzureConf{URL: server.URL + "/threads?api-version=7.0", Auth: "tkn"}
+		assert.NoError(t, az.PublishComment("Total coverage is 75.00%", false))
+		assert.Equal(t, []request{
+			{http.MethodGet, "/threads?api-version=7.0", "Bearer tkn", ""},
+			{http.MethodPatch, "/threads/8/comments/1?api-version=7.0", "Bearer tkn", `{"parentCommentId":0,"content":` + string(content) + `,"commentType":0}`},
+			{http.MethodPatch, "/threads/8?api-version=7.0", "Bearer tkn", `{"status":2}`},
+		}, *requests)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		assert.ErrorContains(t, AzureConf{URL: server.URL, Auth: "tkn"}.PublishComment("", false), "401 Unauthorized")
+	})
+}
+
+func TestAzurePublishAnnotations(t *testing.T) {
+	type request struct {
+		Method, Path, Body string
+	}
+
+	pkgsMap := map[string]Package{"mod/pkg": {Dir: "/src/pkg"}}
+	result := RunResult{
+		Tests: []TestResult{
+			{Package: "mod/pkg", Name: "TestBad", Status: "fail", Output: []string{"    pkg_test.go:12: want 1"}},
+			{Package: "mod/pkg", Name: "TestWorse", Status: "fail", Output: []string{"    pkg_test.go:30: boom"}},
+			{Package: "mod/pkg", Name: "TestGood", Status: "pass", Output: []string{"    pkg_test.go:40: log"}},
+		},
+	}
+
+	az := AzureConf{Auth: "tkn", SourcesDir: "/src"}
+	failures := az.inlineFailures(failureAnnotations(result, pkgsMap))
+	assert.Equal(t, map[string]string{
+		"/pkg/pkg_test.go:12": failureMarker + "\n❌ **Test failed**\n\n`mod/pkg` TestBad\n```\nwant 1\n```",
+		"/pkg/pkg_test.go:30": failureMarker + "\n❌ **Test failed**\n\n`mod/pkg` TestWorse\n```\nboom\n```",
+	}, failures)
+
+	threads := `{"value": [
+		{"id": 1, "comments": [{"id": 1, "content": "` + commentMarker + `"}]},
+		{"id": 2, "comments": [{"id": 5, "content": "` + failureMarker + `"}], "threadContext": {"filePath": "/pkg/pkg_test.go", "rightFileStart": {"line": 12}}},
+		{"id": 3, "comments": [{"id": 1, "content": "` + failureMarker + `"}], "threadContext": {"filePath": "/pkg/pkg_test.go", "rightFileStart": {"line": 20}}},
+		{"id": 4, "comments": [{"id": 1, "content": "reviewer"}], "threadContext": {"filePath": "/pkg/pkg_test.go", "rightFileStart": {"line": 30}}}
+	]}`
+
+	requests := []request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{r.Method, r.URL.Path, string(body)})
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(threads))
+		}
+	}))
+	defer server.Close()
+
+	az.URL = server.URL + "/threads"
+	assert.NoError(t, az.PublishAnnotations(failureAnnotations(result, pkgsMap)))
+
+	updated, _ := json.Marshal(AzureComment{Content: failures["/pkg/pkg_test.go:12"]})
+	created, _ := json.Marshal(AzureBody{
+		Status:        azureThreadActive,
+		Comments:      []AzureComment{{CommentType: 1, Content: failures["/pkg/pkg_test.go:30"]}},
+		ThreadContext: &AzureThreadContext{FilePath: "/pkg/pkg_test.go", RightFileStart: AzureFilePosition{30, 1}, RightFileEnd: AzureFilePosition{30, 1}},
+	})
+	assert.Equal(t, []request{
+		{http.MethodGet, "/threads", ""},
+		{http.MethodPatch, "/threads/2/comments/5", string(updated)},
+		{http.MethodPatch, "/threads/2", `{"status":1}`},
+		{http.MethodPatch, "/threads/3", `{"status":2}`},
+		{http.MethodPost, "/threads", string(created)},
+	}, requests)
+}
+
+func TestAzurePublishStatus(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.RequestURI(), string(data)
+	}))
+	defer server.Close()
+
+	az := AzureConf{URL: server.URL + "/pullRequests/5/threads?api-version=7.0", Auth: "tkn"}
+	assert.NoError(t, az.PublishStatus(true, "1 tests failed"))
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/pullRequests/5/statuses?api-version=7.0", path)
+	assert.Equal(t, `{"state":"failed","description":"1 tests failed","context":{"name":"tests","genre":"gotestiful"}}`, body)
+}
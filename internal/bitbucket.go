@@ -0,0 +1,324 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// bitbucketCloudAPI is the Bitbucket Cloud REST API base url
+var bitbucketCloudAPI = "https://api.bitbucket.org/2.0"
+
+// BitbucketConf holds the Bitbucket Cloud and Server pull request settings, set in the config 'bitbucket' section.
+type BitbucketConf struct {
+	PublishFeatures
+	URL        string `json:"url"`        // Bitbucket Server url eg. https://bitbucket.example.com, Bitbucket Cloud if empty
+	Project    string `json:"project"`    // Server project key or Cloud workspace, defaults to BITBUCKET_WORKSPACE
+	Repository string `json:"repository"` // repository slug, defaults to BITBUCKET_REPO_SLUG
+
+	PullRequest int    `json:"-"` // BITBUCKET_PR_ID
+	Commit      string `json:"-"` // BITBUCKET_COMMIT
+	BuildURL    string `json:"-"` // link of the commit status
+	Token       string `json:"-"` // BITBUCKET_TOKEN
+	Pipelines   bool   `json:"-"` // running in Bitbucket Pipelines
+	CloneDir    string `json:"-"` // repository root, inline comment paths are relative to it
+
+	Publish PublishConf `json:"-"`
+}
+
+// BitbucketConfFromEnv completes the 'conf' settings with the Bitbucket Pipelines variables.
+// Outside Pipelines (eg. Bitbucket Server with Jenkins) set the same variables in the job.
+func BitbucketConfFromEnv(conf BitbucketConf) BitbucketConf {
+	conf.Project = zvfb(conf.Project, os.Getenv("BITBUCKET_WORKSPACE"))
+	conf.Repository = zvfb(conf.Repository, os.Getenv("BITBUCKET_REPO_SLUG"))
+	conf.PullRequest, _ = strconv.Atoi(os.Getenv("BITBUCKET_PR_ID"))
+	conf.Commit = os.Getenv("BITBUCKET_COMMIT")
+	conf.Token = os.Getenv("BITBUCKET_TOKEN")
+	conf.Pipelines = os.Getenv("BITBUCKET_BUILD_NUMBER") != ""
+	conf.CloneDir = os.Getenv("BITBUCKET_CLONE_DIR")
+	if origin := os.Getenv("BITBUCKET_GIT_HTTP_ORIGIN"); origin != "" && conf.Pipelines {
+		conf.BuildURL = origin + "/pipelines/results/" + os.Getenv("BITBUCKET_BUILD_NUMBER")
+	}
+	return conf
+}
+
+// bitbucketComment is a pull request comment of either API, 'Path' is set for inline comments
+type bitbucketComment struct {
+	ID      int
+	Version int // Server only, required to update and delete
+	Text    string
+	Path    string
+	Line    int
+}
+
+func (bb BitbucketConf) Features() PublishFeatures {
+	return bb.PublishFeatures
+}
+
+func (bb BitbucketConf) PublishComment(body string, failed bool) error {
+	comments, err := bb.comments()
+	if err != nil {
+		return err
+	}
+
+	text := commentMarker + "\n" + body
+	for _, c := range comments {
+		if c.Path == "" && strings.Contains(c.Text, commentMarker) {
+			return bb.updateComment(c, text)
+		}
+	}
+
+	return bb.createComment(bitbucketComment{Text: text})
+}
+
+// PublishAnnotations publishes an inline comment at the '_test.go' line of each failure.
+// The comments of a previous run are updated if the line still fails, else deleted (Bitbucket has no resolved state for them).
+func (bb BitbucketConf) PublishAnnotations(annotations []Annotation) error {
+	failures := map[string]bitbucketComment{}
+	keys := []string{}
+	for _, a := range annotations {
+		c := bitbucketComment{Text: failureMarker + "\n" + a.Body, Path: relPath(bb.CloneDir, "", a.File), Line: a.Line}
+		key := sf("%s:%d", c.Path, c.Line)
+		failures[key] = c
+		keys = append(keys, key)
+	}
+
+	comments, err := bb.comments()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		if c.Path == "" || !strings.Contains(c.Text, failureMarker) {
+			continue
+		}
+
+		key := sf("%s:%d", c.Path, c.Line)
+		failure, failing := failures[key]
+		if !failing {
+			err = bb.request(http.MethodDelete, bb.deleteURL(c), nil, nil)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = bb.updateComment(c, failure.Text)
+		if err != nil {
+			return err
+		}
+		delete(failures, key)
+	}
+
+	errs := []error{}
+	for _, key := range keys {
+		if !mapHasKey(failures, key) {
+			continue
+		}
+
+		errs = append(errs, bb.createComment(failures[key]))
+	}
+
+	return joinErrors(errs)
+}
+
+// PublishStatus sets the build status of the pull request commit
+func (bb BitbucketConf) PublishStatus(failed bool, description string) error {
+	if bb.Commit == "" {
+		return fmt.Errorf("bitbucket: the commit is required for the status (BITBUCKET_COMMIT)")
+	}
+
+	status := map[string]string{
+		"key":         "gotestiful",
+		"name":        "gotestiful",
+		"state":       ifelse(failed, "FAILED", "SUCCESSFUL"),
+		"url":         zvfb(bb.BuildURL, bb.repoWebURL()),
+		"description": description,
+	}
+
+	if bb.URL == "" {
+		return bb.request(http.MethodPost, sf("%s/commit/%s/statuses/build", bb.repoURL(), url.PathEscape(bb.Commit)), status, nil)
+	}
+	return bb.request(http.MethodPost, sf("%s/rest/build-status/1.0/commits/%s", bb.serverURL(), url.PathEscape(bb.Commit)), status, nil)
+}
+
+func (bb BitbucketConf) Ready() error {
+	if bb.Project == "" || bb.Repository == "" || bb.PullRequest == 0 || bb.Token == "" {
+		return fmt.Errorf("bitbucket: project, repository, pull request and token are required (BITBUCKET_WORKSPACE, BITBUCKET_REPO_SLUG, BITBUCKET_PR_ID, BITBUCKET_TOKEN)")
+	}
+	return nil
+}
+
+type bitbucketCloudComment struct {
+	ID      int `json:"id,omitempty"`
+	Content struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+	Inline  *bitbucketCloudInline `json:"inline,omitempty"`
+	Deleted bool                  `json:"deleted,omitempty"`
+}
+
+type bitbucketCloudInline struct {
+	Path string `json:"path"`
+	To   int    `json:"to"`
+}
+
+type bitbucketServerComment struct {
+	ID      int                    `json:"id,omitempty"`
+	Version int                    `json:"version"`
+	Text    string                 `json:"text"`
+	Anchor  *bitbucketServerAnchor `json:"anchor,omitempty"`
+}
+
+type bitbucketServerAnchor struct {
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	LineType string `json:"lineType,omitempty"`
+	FileType string `json:"fileType,omitempty"`
+}
+
+// comments lists the pull request comments, following the pages of either API
+func (bb BitbucketConf) comments() ([]bitbucketComment, error) {
+	comments := []bitbucketComment{}
+
+	if bb.URL == "" {
+		next := bb.commentsURL() + "?pagelen=100"
+		for next != "" {
+			var page struct {
+				Values []bitbucketCloudComment `json:"values"`
+				Next   string                  `json:"next"`
+			}
+			err := bb.request(http.MethodGet, next, nil, &page)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, c := range page.Values {
+				if c.Deleted {
+					continue
+				}
+				comment := bitbucketComment{ID: c.ID, Text: c.Content.Raw}
+				if c.Inline != nil {
+					comment.Path, comment.Line = c.Inline.Path, c.Inline.To
+				}
+				comments = append(comments, comment)
+			}
+			next = page.Next
+		}
+
+		return comments, nil
+	}
+
+	// Server lists the comments as pull request activities, the edits of a comment repeat it
+	seen := map[int]bool{}
+	for start, last := 0, false; !last; {
+		var page struct {
+			Values []struct {
+				Action        string                  `json:"action"`
+				Comment       *bitbucketServerComment `json:"comment"`
+				CommentAnchor *bitbucketServerAnchor  `json:"commentAnchor"`
+			} `json:"values"`
+			IsLastPage    bool `json:"isLastPage"`
+			NextPageStart int  `json:"nextPageStart"`
+		}
+		err := bb.request(http.MethodGet, sf("%s/activities?limit=100&start=%d", bb.pullRequestURL(), start), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range page.Values {
+			if a.Action != "COMMENTED" || a.Comment == nil || seen[a.Comment.ID] {
+				continue
+			}
+			seen[a.Comment.ID] = true
+
+			comment := bitbucketComment{ID: a.Comment.ID, Version: a.Comment.Version, Text: a.Comment.Text}
+			anchor := a.Comment.Anchor
+			if anchor == nil {
+				anchor = a.CommentAnchor
+			}
+			if anchor != nil {
+				comment.Path, comment.Line = anchor.Path, anchor.Line
+			}
+			comments = append(comments, comment)
+		}
+		start, last = page.NextPageStart, page.IsLastPage
+	}
+
+	return comments, nil
+}
+
+func (bb BitbucketConf) createComment(c bitbucketComment) error {
+	if bb.URL == "" {
+		body := bitbucketCloudComment{}
+		body.Content.Raw = c.Text
+		if c.Path != "" {
+			body.Inline = &bitbucketCloudInline{Path: c.Path, To: c.Line}
+		}
+		return bb.request(http.MethodPost, bb.commentsURL(), body, nil)
+	}
+
+	body := bitbucketServerComment{Text: c.Text}
+	if c.Path != "" {
+		body.Anchor = &bitbucketServerAnchor{Path: c.Path, Line: c.Line, LineType: "ADDED", FileType: "TO"}
+	}
+	return bb.request(http.MethodPost, bb.commentsURL(), body, nil)
+}
+
+func (bb BitbucketConf) updateComment(c bitbucketComment, text string) error {
+	commentURL := sf("%s/%d", bb.commentsURL(), c.ID)
+
+	if bb.URL == "" {
+		body := bitbucketCloudComment{}
+		body.Content.Raw = text
+		return bb.request(http.MethodPut, commentURL, body, nil)
+	}
+
+	return bb.request(http.MethodPut, commentURL, bitbucketServerComment{Text: text, Version: c.Version}, nil)
+}
+
+func (bb BitbucketConf) deleteURL(c bitbucketComment) string {
+	if bb.URL == "" {
+		return sf("%s/%d", bb.commentsURL(), c.ID)
+	}
+	return sf("%s/%d?version=%d", bb.commentsURL(), c.ID, c.Version)
+}
+
+func (bb BitbucketConf) serverURL() string {
+	return strings.TrimRight(bb.URL, "/")
+}
+
+// repoURL returns the repository REST API url
+func (bb BitbucketConf) repoURL() string {
+	if bb.URL == "" {
+		return sf("%s/repositories/%s/%s", bitbucketCloudAPI, url.PathEscape(bb.Project), url.PathEscape(bb.Repository))
+	}
+	return sf("%s/rest/api/1.0/projects/%s/repos/%s", bb.serverURL(), url.PathEscape(bb.Project), url.PathEscape(bb.Repository))
+}
+
+// repoWebURL returns the repository page, the commit status link when there's no build url
+func (bb BitbucketConf) repoWebURL() string {
+	if bb.URL == "" {
+		return sf("https://bitbucket.org/%s/%s", url.PathEscape(bb.Project), url.PathEscape(bb.Repository))
+	}
+	return sf("%s/projects/%s/repos/%s", bb.serverURL(), url.PathEscape(bb.Project), url.PathEscape(bb.Repository))
+}
+
+func (bb BitbucketConf) pullRequestURL() string {
+	return sf("%s/%s/%d", bb.repoURL(), ifelse(bb.URL == "", "pullrequests", "pull-requests"), bb.PullRequest)
+}
+
+func (bb BitbucketConf) commentsURL() string {
+	return bb.pullRequestURL() + "/comments"
+}
+
+func (bb BitbucketConf) request(method, reqURL string, body, out any) error {
+	return apiClient{
+		name:    "bitbucket",
+		headers: map[string]string{"Authorization": "Bearer " + bb.Token},
+		conf:    bb.Publish,
+	}.request(method, reqURL, body, out)
+}
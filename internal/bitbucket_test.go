@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitbucketConfFromEnv(t *testing.T) {
+	t.Setenv("BITBUCKET_WORKSPACE", "team")
+	t.Setenv("BITBUCKET_REPO_SLUG", "repo")
+	t.Setenv("BITBUCKET_PR_ID", "7")
+	t.Setenv("BITBUCKET_COMMIT", "abc")
+	t.Setenv("BITBUCKET_TOKEN", "tkn")
+	t.Setenv("BITBUCKET_BUILD_NUMBER", "12")
+	t.Setenv("BITBUCKET_CLONE_DIR", "/build")
+	t.Setenv("BITBUCKET_GIT_HTTP_ORIGIN", "https://bitbucket.org/team/repo")
+
+	bb := BitbucketConfFromEnv(BitbucketConf{Repository: "other"})
+	assert.Equal(t, BitbucketConf{
+		Project:     "team",
+		Repository:  "other",
+		PullRequest: 7,
+		Commit:      "abc",
+		BuildURL:    "https://bitbucket.org/team/repo/pipelines/results/12",
+		Token:       "tkn",
+		Pipelines:   true,
+		CloneDir:    "/build",
+	}, bb)
+}
+
+func TestBitbucketPublish(t *testing.T) {
+	type request struct {
+		Method, Path, Auth, Body string
+	}
+
+	// stub replies with the 'responses' of each request uri, '{server}' is replaced with the stub url
+	stub := func(responses map[string]string) (*httptest.Server, *[]request) {
+		requests := []request{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests = append(requests, request{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(body)})
+			_, _ = w.Write([]byte(strings.ReplaceAll(zvfb(responses[r.URL.RequestURI()], "{}"), "{server}", "http://"+r.Host)))
+		}))
+		return server, &requests
+	}
+
+	// the markers as escaped by json.Marshal
+	htmlFailure := strings.NewReplacer("<", `\u003c`, ">", `\u003e`).Replace(failureMarker)
+	htmlComment := strings.NewReplacer("<", `\u003c`, ">", `\u003e`).Replace(commentMarker)
+
+	annotations := []Annotation{
+		{File: "/build/pkg/a_test.go", Line: 12, Body: "want 1"},
+		{File: "/build/pkg/a_test.go", Line: 30, Body: "boom"},
+	}
+
+	t.Run("missing settings", func(t *testing.T) {
+		assert.ErrorContains(t, BitbucketConf{Project: "team"}.Ready(), "bitbucket: project, repository, pull request and token are required")
+	})
+
+	t.Run("cloud comment", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"/repositories/team/repo/pullrequests/7/comments?pagelen=100": `{"values": [{"id": 1, "content": {"raw": "someone else"}}], "next": "{server}/repositories/team/repo/pullrequests/7/comments?page=2"}`,
+			"/repositories/team/repo/pullrequests/7/comments?page=2":      `{"values": [{"id": 4, "content": {"raw": "` + commentMarker + `"}}]}`,
+		})
+		defer server.Close()
+		setCloudAPI(t, server.URL)
+
+		bb := BitbucketConf{Project: "team", Repository: "repo", PullRequest: 7, Token: "tkn"}
+		assert.NoError(t, bb.PublishComment("Total coverage is 75.00%", false))
+		assert.Equal(t, []request{
+			{http.MethodGet, "/repositories/team/repo/pullrequests/7/comments?pagelen=100", "Bearer tkn", ""},
+			{http.MethodGet, "/repositories/team/repo/pullrequests/7/comments?page=2", "Bearer tkn", ""},
+			{http.MethodPut, "/repositories/team/repo/pullrequests/7/comments/4", "Bearer tkn", `{"content":{"raw":"` + htmlComment + `\nTotal coverage is 75.00%"}}`},
+		}, *requests)
+	})
+
+	t.Run("cloud inline comments", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"/repositories/team/repo/pullrequests/7/comments?pagelen=100": `{"values": [
+				{"id": 2, "content": {"raw": "` + failureMarker + `"}, "inline": {"path": "pkg/a_test.go", "to": 12}},
+				{"id": 3, "content": {"raw": "` + failureMarker + `"}, "inline": {"path": "pkg/a_test.go", "to": 20}},
+				{"id": 5, "content": {"raw": "` + failureMarker + `"}, "inline": {"path": "pkg/a_test.go", "to": 25}, "deleted": true},
+				{"id": 6, "content": {"raw": "reviewer"}, "inline": {"path": "pkg/a_test.go", "to": 30}}
+			]}`,
+		})
+		defer server.Close()
+		setCloudAPI(t, server.URL)
+
+		bb := BitbucketConf{Project: "team", Repository: "repo", PullRequest: 7, Token: "tkn", CloneDir: "/build"}
+		assert.NoError(t, bb.PublishAnnotations(annotations))
+		assert.Equal(t, []request{
+			{http.MethodGet, "/repositories/team/repo/pullrequests/7/comments?pagelen=100", "Bearer tkn", ""},
+			{http.MethodPut, "/repositories/team/repo/pullrequests/7/comments/2", "Bearer tkn", `{"content":{"raw":"` + htmlFailure + `\nwant 1"}}`},
+			{http.MethodDelete, "/repositories/team/repo/pullrequests/7/comments/3", "Bearer tkn", ""},
+			{http.MethodPost, "/repositories/team/repo/pullrequests/7/comments", "Bearer tkn", `{"content":{"raw":"` + htmlFailure + `\nboom"},"inline":{"path":"pkg/a_test.go","to":30}}`},
+		}, *requests)
+	})
+
+	t.Run("cloud status", func(t *testing.T) {
+		server, requests := stub(nil)
+		defer server.Close()
+		setCloudAPI(t, server.URL)
+
+		bb := BitbucketConf{Project: "team", Repository: "repo", PullRequest: 7, Token: "tkn"}
+		assert.ErrorContains(t, bb.PublishStatus(true, "1 tests failed"), "commit is required")
+
+		bb.Commit = "abc"
+		assert.NoError(t, bb.PublishStatus(true, "1 tests failed"))
+		assert.Equal(t, []request{
+			{http.MethodPost, "/repositories/team/repo/commit/abc/statuses/build", "Bearer tkn", `{"description":"1 tests failed","key":"gotestiful","name":"gotestiful","state":"FAILED","url":"https://bitbucket.org/team/repo"}`},
+		}, *requests)
+	})
+
+	t.Run("server comments and status", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"/rest/api/1.0/projects/PRJ/repos/repo/pull-requests/7/activities?limit=100&start=0": `{"values": [
+				{"action": "COMMENTED", "comment": {"id": 2, "version": 3, "text": "` + failureMarker + `"}, "commentAnchor": {"path": "pkg/a_test.go", "line": 20}},
+				{"action": "APPROVED"}
+			], "isLastPage": false, "nextPageStart": 2}`,
+			"/rest/api/1.0/projects/PRJ/repos/repo/pull-requests/7/activities?limit=100&start=2": `{"values": [
+				{"action": "COMMENTED", "comment": {"id": 4, "version": 1, "text": "` + commentMarker + `"}},
+				{"action": "COMMENTED", "comment": {"id": 2, "version": 2, "text": "` + failureMarker + `"}}
+			], "isLastPage": true}`,
+		})
+		defer server.Close()
+
+		bb := BitbucketConf{URL: server.URL + "/", Project: "PRJ", Repository: "repo", PullRequest: 7, Commit: "abc", Token: "tkn", CloneDir: "/build"}
+		assert.NoError(t, bb.PublishAnnotations(annotations[:1]))
+		assert.NoError(t, bb.PublishComment("Total coverage is 75.00%", false))
+		assert.NoError(t, bb.PublishStatus(false, "Tests passed"))
+
+		prURL := "/rest/api/1.0/projects/PRJ/repos/repo/pull-requests/7"
+		assert.Equal(t, []request{
+			{http.MethodGet, prURL + "/activities?limit=100&start=0", "Bearer tkn", ""},
+			{http.MethodGet, prURL + "/activities?limit=100&start=2", "Bearer tkn", ""},
+			{http.MethodDelete, prURL + "/comments/2?version=3", "Bearer tkn", ""},
+			{http.MethodPost, prURL + "/comments", "Bearer tkn", `{"version":0,"text":"` + htmlFailure + `\nwant 1","anchor":{"path":"pkg/a_test.go","line":12,"lineType":"ADDED","fileType":"TO"}}`},
+			{http.MethodGet, prURL + "/activities?limit=100&start=0", "Bearer tkn", ""},
+			{http.MethodGet, prURL + "/activities?limit=100&start=2", "Bearer tkn", ""},
+			{http.MethodPut, prURL + "/comments/4", "Bearer tkn", `{"version":1,"text":"` + htmlComment + `\nTotal coverage is 75.00%"}`},
+			{http.MethodPost, "/rest/build-status/1.0/commits/abc", "Bearer tkn", `{"description":"Tests passed","key":"gotestiful","name":"gotestiful","state":"SUCCESSFUL","url":"` + server.URL + `/projects/PRJ/repos/repo"}`},
+		}, *requests)
+	})
+}
+
+func setCloudAPI(t *testing.T, apiURL string) {
+	prev := bitbucketCloudAPI
+	bitbucketCloudAPI = apiURL
+	t.Cleanup(func() { bitbucketCloudAPI = prev })
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// coverBlock is a line of a cover profile eg. 'mod/pkg/file.go:10.2,12.16 2 1'
+type coverBlock struct {
+	File      string // import path of the file eg. mod/pkg/file.go
+	StartLine int
+	EndLine   int
+	NumStmt   int
+	Count     int
+}
+
+var regexCoverBlock = regexp.MustCompile(`^(.+):(\d+)\.\d+,(\d+)\.\d+ (\d+) (\d+)$`)
+
+// parseCoverProfile reads the blocks of a 'go test -coverprofile' file
+func parseCoverProfile(coverProfile string) ([]coverBlock, error) {
+	file, err := os.Open(coverProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover profile: %w", err)
+	}
+	defer file.Close()
+
+	blocks := []coverBlock{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := regexCoverBlock.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue // mode line
+		}
+
+		block := coverBlock{File: match[1]}
+		block.StartLine, _ = strconv.Atoi(match[2])
+		block.EndLine, _ = strconv.Atoi(match[3])
+		block.NumStmt, _ = strconv.Atoi(match[4])
+		block.Count, _ = strconv.Atoi(match[5])
+		blocks = append(blocks, block)
+	}
+
+	return blocks, scanner.Err()
+}
+
+// coberturaReporter converts the cover profile to a Cobertura XML report once the run is done
+type coberturaReporter struct {
+	nopReporter
+	filePath     string
+	coverProfile string
+	pkgsMap      map[string]Package
+}
+
+func (r coberturaReporter) OnSummary(result RunResult) error {
+	return writeCobertura(r.filePath, r.coverProfile, r.pkgsMap)
+}
+
+// buildCobertura converts cover profile blocks to a Cobertura report with file paths relative to 'root'
+func buildCobertura(blocks []coverBlock, pkgsMap map[string]Package, root string) coberturaCoverage {
+	// line hits per file per package
+	hits := map[string]map[string]map[int]int{}
+	for _, b := range blocks {
+		pkg := path.Dir(b.File)
+		if hits[pkg] == nil {
+			hits[pkg] = map[string]map[int]int{}
+		}
+		if hits[pkg][b.File] == nil {
+			hits[pkg][b.File] = map[int]int{}
+		}
+		for line := b.StartLine; line <= b.EndLine; line++ {
+			hits[pkg][b.File][line] = ifelse(hits[pkg][b.File][line] < b.Count, b.Count, hits[pkg][b.File][line])
+		}
+	}
+
+	report := coberturaCoverage{
+		BranchRate: "0",
+		Version:    "gotestiful",
+		Timestamp:  time.Now().UnixMilli(),
+		Sources:    []string{root},
+	}
+
+	for _, pkgName := range mapSortedKeys(hits) {
+		pkg := coberturaPackage{Name: pkgName, BranchRate: "0"}
+		pkgCovered, pkgValid := 0, 0
+
+		for _, fileName := range mapSortedKeys(hits[pkgName]) {
+			class := coberturaClass{
+				Name:       path.Base(fileName),
+				Filename:   coberturaFilename(fileName, pkgsMap, root),
+				BranchRate: "0",
+			}
+
+			covered := 0
+			for _, line := range mapSortedKeys(hits[pkgName][fileName]) {
+				lineHits := hits[pkgName][fileName][line]
+				class.Lines = append(class.Lines, coberturaLine{Number: line, Hits: lineHits})
+				covered += ifelse(lineHits > 0, 1, 0)
+			}
+
+			class.LineRate = coberturaRate(covered, len(class.Lines))
+			pkgCovered += covered
+			pkgValid += len(class.Lines)
+			pkg.Classes = append(pkg.Classes, class)
+		}
+
+		pkg.LineRate = coberturaRate(pkgCovered, pkgValid)
+		report.LinesCovered += pkgCovered
+		report.LinesValid += pkgValid
+		report.Packages = append(report.Packages, pkg)
+	}
+
+	report.LineRate = coberturaRate(report.LinesCovered, report.LinesValid)
+
+	return report
+}
+
+// writeCobertura converts the cover profile to a Cobertura XML report at 'filePath'
+func writeCobertura(filePath, coverProfile string, pkgsMap map[string]Package) error {
+	blocks, err := parseCoverProfile(coverProfile)
+	if err != nil {
+		return err
+	}
+
+	root, err := getPWD()
+	if err != nil {
+		return err
+	}
+
+	data, err := xml.MarshalIndent(buildCobertura(blocks, pkgsMap, root), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to build cobertura report: %w", err)
+	}
+
+	err = os.WriteFile(filePath, append([]byte(xml.Header), data...), 0o666)
+	if err != nil {
+		return fmt.Errorf("failed to write cobertura report: %w", err)
+	}
+
+	return nil
+}
+
+// coberturaFilename maps a cover profile file (import path) to its path relative to 'root'
+func coberturaFilename(file string, pkgsMap map[string]Package, root string) string {
+	pkg, ok := pkgsMap[path.Dir(file)]
+	if !ok || pkg.Dir == "" {
+		return file
+	}
+
+	rel, err := filepath.Rel(root, filepath.Join(pkg.Dir, path.Base(file)))
+	if err != nil {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
+
+func coberturaRate(covered, valid int) string {
+	if valid == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', 4, 64)
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCoverProfile(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "coverage.out")
+	err := os.WriteFile(profile, []byte("mode: set\nmod/pkg/file.go:3.20,5.2 2 1\nmod/pkg/file.go:7.10,7.30 1 0\n"), 0o666)
+	assert.NoError(t, err)
+
+	blocks, err := parseCoverProfile(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, []coverBlock{
+		{File: "mod/pkg/file.go", StartLine: 3, EndLine: 5, NumStmt: 2, Count: 1},
+		{File: "mod/pkg/file.go", StartLine: 7, EndLine: 7, NumStmt: 1, Count: 0},
+	}, blocks)
+
+	_, err = parseCoverProfile(filepath.Join(t.TempDir(), "missing.out"))
+	assert.Error(t, err)
+}
+
+func TestBuildCobertura(t *testing.T) {
+	blocks := []coverBlock{
+		{File: "mod/pkg/file.go", StartLine: 3, EndLine: 5, NumStmt: 2, Count: 1},
+		{File: "mod/pkg/file.go", StartLine: 5, EndLine: 6, NumStmt: 1, Count: 0},
+		{File: "mod/other/b.go", StartLine: 1, EndLine: 1, NumStmt: 1, Count: 0},
+	}
+	pkgsMap := map[string]Package{"mod/pkg": {Dir: "/repo/pkg", ImportPath: "mod/pkg"}}
+
+	report := buildCobertura(blocks, pkgsMap, "/repo")
+
+	assert.Equal(t, 3, report.LinesCovered)
+	assert.Equal(t, 5, report.LinesValid)
+	assert.Equal(t, "0.6000", report.LineRate)
+	assert.Equal(t, []string{"/repo"}, report.Sources)
+	assert.Len(t, report.Packages, 2)
+
+	other := report.Packages[0]
+	assert.Equal(t, "mod/other", other.Name)
+	assert.Equal(t, "mod/other/b.go", other.Classes[0].Filename) // not a tested package, keeps import path
+
+	pkg := report.Packages[1]
+	assert.Equal(t, "mod/pkg", pkg.Name)
+	assert.Equal(t, "0.7500", pkg.LineRate)
+	assert.Equal(t, []coberturaClass{{
+		Name:       "file.go",
+		Filename:   "pkg/file.go",
+		LineRate:   "0.7500",
+		BranchRate: "0",
+		Lines:      []coberturaLine{{3, 1}, {4, 1}, {5, 1}, {6, 0}},
+	}}, pkg.Classes)
+}
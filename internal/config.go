@@ -1,80 +1,506 @@
 package internal
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
 )
 
 const configFileName = ".gotestiful"
 
+// configFileNames are the supported config files, one per format
+var configFileNames = []string{configFileName, configFileName + ".yaml", configFileName + ".yml", configFileName + ".toml"}
+
 type config struct {
-	Color        bool     `json:"color"`
-	Cache        bool     `json:"cache"`
-	Cover        bool     `json:"cover"`
-	Report       bool     `json:"report"`
-	CoverProfile string   `json:"coverProfile"`
-	Verbose      bool     `json:"verbose"`
-	ListIgnored  bool     `json:"listIgnored"`
-	SkipEmpty    bool     `json:"skipEmpty"`
-	ListEmpty    bool     `json:"listEmpty"`
-	FullCoverage bool     `json:"fullCoverage"`
-	Exclude      []string `json:"exclude"`
-	TestOutput   string   `json:"testOutput"`
+	Version         int                    `json:"version"` // config format, see configVersion
+	Output          OutputConf             `json:"output"`
+	Cache           bool                   `json:"cache"`
+	Coverage        CoverageConf           `json:"coverage"`
+	Include         []string               `json:"include"`
+	Exclude         []string               `json:"exclude"`
+	TestOutput      string                 `json:"testOutput"`
+	JUnit           string                 `json:"junit"`
+	Cobertura       string                 `json:"cobertura"`
+	SummaryJSON     string                 `json:"summaryJson"`
+	Template        string                 `json:"template"`
+	TemplateOutput  string                 `json:"templateOutput"`
+	CommentTemplate string                 `json:"commentTemplate"`
+	Baseline        string                 `json:"baseline"`
+	Notify          []NotifyConf           `json:"notify"`
+	Packages        map[string]PackageConf `json:"packages"` // per-package 'go test' settings keyed by pattern
+	Azure           AzureConf              `json:"azure"`
+	Bitbucket       BitbucketConf          `json:"bitbucket"`
+	Gitea           GiteaConf              `json:"gitea"`
+	GitHub          GitHubConf             `json:"github"`
+	GitLab          GitLabConf             `json:"gitlab"`
+	Publish         PublishConf            `json:"publish"`
+
+	Profiles map[string]json.RawMessage `json:"profiles"` // named partial configs eg. 'ci', selected with -profile or GOTESTIFUL_PROFILE
+}
+
+// OutputConf holds the terminal output settings, set in the config 'output' section
+type OutputConf struct {
+	Color       bool `json:"color"`
+	Verbose     bool `json:"verbose"`
+	ListIgnored bool `json:"listIgnored"`
+	SkipEmpty   bool `json:"skipEmpty"`
+	ListEmpty   bool `json:"listEmpty"`
+}
+
+// CoverageConf holds the coverage settings, set in the config 'coverage' section
+type CoverageConf struct {
+	Enabled bool   `json:"enabled"` // go test -cover
+	Report  bool   `json:"report"`  // open the html report
+	Profile string `json:"profile"` // cover profile path
+	Full    bool   `json:"full"`    // count the packages without tests
 }
 
 // Default config values
 var conf = config{
-	Color: true,
+	Version: configVersion,
+	Output: OutputConf{
+		Color:     true,
+		SkipEmpty: true,
+		// Verbose:     false,
+		// ListIgnored: false,
+		// ListEmpty:   false,
+	},
 	Cache: true,
-	Cover: true,
-	// Report:       false,
-	// CoverProfile: "",
-	// Verbose:      false,
-	// ListIgnored:  false,
-	SkipEmpty: true,
-	// ListEmpty:    false,
+	Coverage: CoverageConf{
+		Enabled: true,
+		// Report:  false,
+		// Profile: "",
+		// Full:    false,
+	},
+	Include: []string{},
 	Exclude: []string{},
 	// TestOutput: "",
-	// FullCoverage: false,
+	// JUnit: "",
+	// Cobertura: "",
+	// SummaryJSON: "",
+	// Template: "",
+	// TemplateOutput: "",
+	// CommentTemplate: "",
+	// Baseline: "",
+	Notify:   []NotifyConf{},
+	Packages: map[string]PackageConf{},
+	// Azure: AzureConf{},
+	// Bitbucket: BitbucketConf{},
+	// Gitea: GiteaConf{},
+	// GitHub: GitHubConf{},
+	// GitLab: GitLabConf{},
+	// Publish: PublishConf{},
+	Profiles: map[string]json.RawMessage{},
 }
 
-func GetConfig() (config, error) {
-	pwd, err := getPWD()
+// GetConfig layers the config sources, each one overriding the keys it sets:
+// defaults, the global config (personal preferences), the project config, the selected 'profile',
+// then the environment (CI variables) and the flags, applied by the caller.
+// The settings are checked once resolved, see ValidateConfig.
+func GetConfig(profile string) (config, error) {
+	c, _, err := loadConfig(profile)
 	if err != nil {
 		return config{}, err
 	}
-	confPath := filepath.Join(pwd, configFileName)
+	return c, nil
+}
+
+// loadConfig layers the config sources and returns the source of each key set eg. 'project /mod/.gotestiful'
+func loadConfig(profile string) (config, configSources, error) {
+	pwd, err := getPWD()
+	if err != nil {
+		return config{}, nil, err
+	}
+
+	globalPath, err := findGlobalConfigFile()
+	if err != nil {
+		return config{}, nil, err
+	}
+
+	projectPath, err := findProjectConfigFile(pwd)
+	if err != nil {
+		return config{}, nil, err
+	}
+
+	c := conf
+	c.Profiles = map[string]json.RawMessage{} // decoding merges into maps, keep the defaults one intact
+	c.Packages = map[string]PackageConf{}
+	sources := configSources{}
+
+	for _, confPath := range []string{globalPath, projectPath} {
+		if confPath == "" {
+			continue
+		}
+
+		keys, err := readConfigFile(confPath, &c)
+		if err != nil {
+			return config{}, nil, err
+		}
+		sources.set(keys, ifelse(confPath == globalPath, "global ", "project ")+confPath)
+	}
+
+	err = c.validateProfiles()
+	if err != nil {
+		return config{}, nil, err
+	}
+
+	keys, err := c.applyProfile(profile)
+	if err != nil {
+		return config{}, nil, err
+	}
+	sources.set(keys, "profile "+profile)
+
+	keys, err = c.applyEnv(os.LookupEnv)
+	if err != nil {
+		return config{}, nil, err
+	}
+	for _, key := range keys {
+		sources[key] = "env " + configEnvName(key)
+	}
+
+	return c, sources, nil
+}
+
+// configEnvPrefix prefixes the environment variables of the config keys eg. GOTESTIFUL_COVERAGE_ENABLED or GOTESTIFUL_AZURE_COMMENT
+const configEnvPrefix = "GOTESTIFUL_"
+
+// applyEnv overrides the config keys with their GOTESTIFUL_* environment variables, parsed as the flags.
+// Lists are comma separated eg. GOTESTIFUL_EXCLUDE=a,b and the 'notify' list is JSON.
+// Returns the keys set.
+func (c *config) applyEnv(lookupEnv func(key string) (string, bool)) ([]string, error) {
+	keys := []string{}
+	var err error
+	walkConfigFields(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+		name := configEnvName(key)
+		val, ok := lookupEnv(name)
+		if legacy := legacyConfigKey(key); !ok && legacy != "" {
+			// the variables of the keys moved in config version 2 eg. GOTESTIFUL_COVER
+			val, ok = lookupEnv(configEnvName(legacy))
+			if ok {
+				warnDeprecated(sf("%s is deprecated, use %s", configEnvName(legacy), name))
+			}
+		}
+		if !ok || err != nil {
+			return
+		}
+		err = setConfigField(field, val)
+		if err != nil {
+			err = fmt.Errorf("invalid value %q for %s: %w", val, name, err)
+		}
+		keys = append(keys, key)
+	})
+	return keys, err
+}
+
+// walkConfigFields calls 'fn' with the dotted json key eg. 'azure.comment' of each setting of the struct 'v'
+func walkConfigFields(v reflect.Value, prefix string, fn func(key string, field reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		switch {
+		case name == "-" || !field.IsExported():
+		case field.Anonymous && name == "":
+			walkConfigFields(v.Field(i), prefix, fn) // flattened eg. PublishFeatures
+		case prefix == "" && name == "profiles": // selected before the environment is applied
+		case prefix == "" && name == "version": // of the files
+		case field.Type.Kind() == reflect.Struct:
+			walkConfigFields(v.Field(i), prefix+name+".", fn)
+		default:
+			fn(prefix+name, v.Field(i))
+		}
+	}
+}
+
+var regexCamelCase = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// configEnvName returns the environment variable of a config key eg. 'azure.inlineComments' is GOTESTIFUL_AZURE_INLINE_COMMENTS
+func configEnvName(key string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(regexCamelCase.ReplaceAllString(key, "${1}_${2}"), ".", "_"))
+}
+
+// setConfigField parses 'val' into the config 'field' with the flags parsing eg. strconv.ParseBool for booleans
+func setConfigField(field reflect.Value, val string) error {
+	switch field.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return errors.New("parse error")
+		}
+		field.SetBool(b)
 
-	if fileExists(confPath) {
-		confBytes, err := readFile(confPath)
+	case reflect.Int:
+		n, err := strconv.ParseInt(val, 0, strconv.IntSize)
 		if err != nil {
-			return config{}, fmt.Errorf("failed to read config file: %w", err)
+			return errors.New("parse error")
 		}
+		field.SetInt(n)
+
+	case reflect.String:
+		field.SetString(val)
+
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			items := []string{}
+			for _, item := range strings.Split(val, ",") {
+				items = sliceAppendIf(strings.TrimSpace(item) != "", items, strings.TrimSpace(item))
+			}
+			field.Set(reflect.ValueOf(items))
+			return nil
+		}
+		return json.Unmarshal([]byte(val), field.Addr().Interface())
+
+	default:
+		return json.Unmarshal([]byte(val), field.Addr().Interface())
+	}
+
+	return nil
+}
+
+// applyProfile overrides the config with the keys set in the 'profile', a profile of the global config applies to any project.
+// Returns the keys set.
+func (c *config) applyProfile(profile string) ([]string, error) {
+	if profile == "" {
+		return nil, nil
+	}
+
+	values, ok := c.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("config profile '%s' not found (profiles: %s)", profile, strings.Join(mapSortedKeys(c.Profiles), ", "))
+	}
+
+	keys, err := decodeConfig(values, c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config profile '%s': %w", profile, err)
+	}
+	return keys, nil
+}
 
-		err = json.Unmarshal(confBytes, &conf)
+// validateProfiles checks the keys of all the profiles, not only the selected one, so mistakes show up early
+func (c config) validateProfiles() error {
+	for _, name := range mapSortedKeys(c.Profiles) {
+		var scratch config
+		keys, err := decodeConfig(c.Profiles[name], &scratch)
 		if err != nil {
-			return config{}, fmt.Errorf("failed to read config file: %w", err)
+			return fmt.Errorf("invalid config profile '%s': %w", name, err)
+		}
+		if slices.Contains(keys, "profiles") {
+			return fmt.Errorf("invalid config profile '%s': profiles can not be nested", name)
+		}
+	}
+	return nil
+}
+
+// ProfileFromArgs returns the -profile flag value, parsed ahead of the other flags as their defaults come from the profile.
+// Defaults to the GOTESTIFUL_PROFILE environment variable.
+func ProfileFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "profile" {
+			continue
+		}
+		if hasValue {
+			return value
 		}
+		return sliceAt(args, i+1, "")
 	}
 
-	return conf, nil
+	return os.Getenv("GOTESTIFUL_PROFILE")
 }
 
-// Creates a config file in the current path with default values
-func InitConfig() error {
+// findProjectConfigFile looks for the config file from 'dir' up to the module root, the first directory holding a go.mod or go.work
+func findProjectConfigFile(dir string) (string, error) {
+	for {
+		confPath, err := findConfigFile(dir)
+		if err != nil || confPath != "" {
+			return confPath, err
+		}
+
+		if fileExists(filepath.Join(dir, "go.mod")) || fileExists(filepath.Join(dir, "go.work")) {
+			return "", nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// findGlobalConfigFile returns the user config file '$XDG_CONFIG_HOME/gotestiful/config' (with an optional .yaml, .yml or .toml extension),
+// empty if there's none. Without XDG_CONFIG_HOME the OS user config dir is used eg. ~/.config
+func findGlobalConfigFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		var err error
+		dir, err = os.UserConfigDir()
+		if err != nil {
+			return "", nil // no home directory eg. in some containers
+		}
+	}
+
+	return findOneFile(filepath.Join(dir, "gotestiful"), []string{"config", "config.yaml", "config.yml", "config.toml"})
+}
+
+// findConfigFile returns the config file in 'dir', empty if there's none
+func findConfigFile(dir string) (string, error) {
+	return findOneFile(dir, configFileNames)
+}
+
+// findOneFile returns the one of the 'names' files that exists in 'dir', empty if there's none.
+// More than one is an error as it would be unclear which one applies.
+func findOneFile(dir string, names []string) (string, error) {
+	found := []string{}
+	for _, name := range names {
+		found = sliceAppendIf(fileExists(filepath.Join(dir, name)), found, filepath.Join(dir, name))
+	}
+
+	if len(found) > 1 {
+		return "", fmt.Errorf("multiple config files found, keep only one: %s", strings.Join(found, ", "))
+	}
+	return sliceAt(found, 0, ""), nil
+}
+
+// readConfigFile reads the config file over 'c', the format is detected by the file extension.
+// YAML and TOML files share the JSON keys. Returns the keys set.
+func readConfigFile(confPath string, c *config) ([]string, error) {
+	confBytes, err := readFile(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	doc, err := parseConfigNode(confPath, confBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", confPath, err)
+	}
+
+	// Older formats still load, until the file is migrated
+	from, changed, err := migrateConfigNode(doc.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", confPath, err)
+	}
+	if changed {
+		warnDeprecated(sf("%s uses the deprecated config version %d, run 'gotestiful config migrate' to upgrade it", confPath, from))
+	}
+
+	var values map[string]any
+	err = doc.Content[0].Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", confPath, err)
+	}
+
+	delete(values, "$schema") // editors reference of the config JSON Schema
+
+	// Decode the values through JSON so all formats share the json tags
+	confBytes, err = json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", confPath, err)
+	}
+
+	keys, err := decodeConfig(confBytes, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", confPath, err)
+	}
+	return keys, nil
+}
+
+// decodeConfig decodes the JSON 'data' over 'c', rejecting unknown keys instead of ignoring them (eg. typos).
+// Returns the dotted keys set eg. 'azure.comment'.
+func decodeConfig(data []byte, c *config) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(c)
+	if err != nil {
+		return nil, errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	var values map[string]any
+	_ = json.Unmarshal(data, &values)
+
+	keys := []string{}
+	if mapHasKey(values, "profiles") {
+		keys = append(keys, "profiles")
+	}
+	walkConfigFields(reflect.ValueOf(c).Elem(), "", func(key string, _ reflect.Value) {
+		val := any(values)
+		for _, part := range strings.Split(key, ".") {
+			obj, _ := val.(map[string]any)
+			if !mapHasKey(obj, part) {
+				return
+			}
+			val = obj[part]
+		}
+		keys = append(keys, key)
+	})
+	return keys, nil
+}
+
+// configFormat returns the format of a config file by its extension: json, yaml or toml
+func configFormat(confPath string) string {
+	switch filepath.Ext(confPath) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// Creates a config file in the current path, 'format' is json, yaml or toml.
+// The module packages are inspected to propose excludes and settings, accepted without asking if 'yes'.
+func InitConfig(format string, yes bool) error {
 	pwd, err := getPWD()
 	if err != nil {
 		return err
 	}
-	confPath := filepath.Join(pwd, configFileName)
 
-	if fileExists(confPath) {
-		return fmt.Errorf("config file already exits at %s", confPath)
+	var confPath string
+	switch format {
+	case "", "json":
+		confPath = filepath.Join(pwd, configFileName)
+	case "yaml", "toml":
+		confPath = filepath.Join(pwd, configFileName+"."+format)
+	default:
+		return fmt.Errorf("unknown config format '%s' (json, yaml or toml)", format)
 	}
 
-	data, _ := json.MarshalIndent(conf, "", "  ")
+	existing, err := findConfigFile(pwd)
+	if err != nil {
+		return err
+	}
+	if existing != "" {
+		return fmt.Errorf("config file already exits at %s", existing)
+	}
+
+	c := conf
+	pkgs, err := listModulePackages()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: cannot inspect the packages, writing the default config:", err)
+	} else {
+		c = initWizard(suggestConfig(pkgs, moduleRoot(pwd)), yes, prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout})
+	}
+
+	data, err := encodeConfig(c, zvfb(format, "json"))
+	if err != nil {
+		return fmt.Errorf("failed to init config: %w", err)
+	}
+	data = withSchemaReference(data, zvfb(format, "json"))
 
 	err = os.WriteFile(confPath, data, 0644)
 
@@ -82,5 +508,112 @@ func InitConfig() error {
 		return fmt.Errorf("failed to init config: %w", err)
 	}
 
+	fmt.Println("Created", confPath)
 	return nil
 }
+
+// encodeConfig formats 'c' as json, yaml or toml, keeping the keys in the struct order
+func encodeConfig(c config, format string) ([]byte, error) {
+	data, _ := json.MarshalIndent(c, "", "  ")
+	if format == "json" {
+		return data, nil
+	}
+
+	// JSON is valid YAML, its node tree keeps the keys order
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+
+	if format == "toml" {
+		var buf bytes.Buffer
+		writeTOMLTable(&buf, "", "", root)
+		return bytes.TrimLeft(buf.Bytes(), "\n"), nil
+	}
+
+	blockStyle(root)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(root)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle drops the JSON flow style of the collections, except the empty ones eg. 'exclude: []'
+func blockStyle(node *yaml.Node) {
+	if len(node.Content) > 0 {
+		node.Style = 0
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		node.Style = ifelse(node.Value == "", yaml.DoubleQuotedStyle, 0)
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// writeTOMLTable writes the keys of the mapping 'node' under the 'header' eg. '[azure]': values first, then the sub tables and arrays of tables.
+// 'name' is the table path prefixing the sub tables.
+func writeTOMLTable(buf *bytes.Buffer, header, name string, node *yaml.Node) {
+	tables := []int{}
+
+	if header != "" {
+		fmt.Fprintf(buf, "\n%s\n", header)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key, val := node.Content[i].Value, node.Content[i+1]
+		switch {
+		case val.Tag == "!!null": // TOML has no null, leave the default
+		case val.Kind == yaml.MappingNode || (val.Kind == yaml.SequenceNode && len(val.Content) > 0 && val.Content[0].Kind == yaml.MappingNode):
+			tables = append(tables, i)
+		default:
+			fmt.Fprintf(buf, "%s = %s\n", tomlKey(key), tomlValue(val))
+		}
+	}
+
+	for _, i := range tables {
+		key, val := node.Content[i].Value, node.Content[i+1]
+		table := strings.TrimPrefix(name+"."+tomlKey(key), ".")
+
+		if val.Kind == yaml.MappingNode {
+			writeTOMLTable(buf, "["+table+"]", table, val)
+			continue
+		}
+
+		for _, item := range val.Content {
+			writeTOMLTable(buf, "[["+table+"]]", table, item)
+		}
+	}
+}
+
+var regexTOMLBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(key string) string {
+	if regexTOMLBareKey.MatchString(key) {
+		return key
+	}
+	quoted, _ := json.Marshal(key)
+	return string(quoted)
+}
+
+// tomlValue formats a scalar or array node. JSON strings are valid TOML basic strings.
+func tomlValue(node *yaml.Node) string {
+	if node.Kind == yaml.SequenceNode {
+		items := []string{}
+		for _, item := range node.Content {
+			items = append(items, tomlValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	if node.Tag == "!!str" {
+		quoted, _ := json.Marshal(node.Value)
+		return string(quoted)
+	}
+	return node.Value
+}
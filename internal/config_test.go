@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+
+	found, err := findConfigFile(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "", found)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".gotestiful.yml"), nil, 0o666))
+	found, err = findConfigFile(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ".gotestiful.yml"), found)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".gotestiful"), nil, 0o666))
+	_, err = findConfigFile(dir)
+	assert.ErrorContains(t, err, "multiple config files found, keep only one: "+filepath.Join(dir, ".gotestiful")+", "+filepath.Join(dir, ".gotestiful.yml"))
+}
+
+func TestReadConfigFile(t *testing.T) {
+	files := map[string]string{
+		".gotestiful": `{"version": 2, "output": {"color": false}, "exclude": ["mod/gen"], "azure": {"comment": true}, "notify": [{"url": "https://chat", "headers": {"X-Key": "${KEY}"}}]}`,
+		".gotestiful.yaml": `
+version: 2
+output:
+  color: false
+exclude:
+  - mod/gen # generated protobuf
+azure:
+  comment: true
+notify:
+  - url: https://chat
+    headers:
+      X-Key: ${KEY}
+`,
+		".gotestiful.toml": `
+version = 2
+exclude = ["mod/gen"] # generated protobuf
+
+[output]
+color = false
+
+[azure]
+comment = true
+
+[[notify]]
+url = "https://chat"
+headers = { X-Key = "${KEY}" }
+`,
+	}
+
+	want := conf
+	want.Output.Color = false
+	want.Exclude = []string{"mod/gen"}
+	want.Azure.Comment = true
+	want.Notify = []NotifyConf{{URL: "https://chat", Headers: map[string]string{"X-Key": "${KEY}"}}}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			assert.NoError(t, os.WriteFile(path, []byte(content), 0o666))
+
+			c := conf
+			keys, err := readConfigFile(path, &c)
+			assert.NoError(t, err)
+			assert.Equal(t, want, c)
+			assert.Equal(t, []string{"output.color", "exclude", "notify", "azure.comment"}, keys)
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), ".gotestiful.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("color: [nope"), 0o666))
+	c := conf
+	_, err := readConfigFile(path, &c)
+	assert.ErrorContains(t, err, "failed to read config file "+path)
+
+	assert.NoError(t, os.WriteFile(path, []byte("colour: false"), 0o666))
+	_, err = readConfigFile(path, &c)
+	assert.EqualError(t, err, "failed to read config file "+path+`: unknown field "colour"`)
+}
+
+func TestEncodeConfig(t *testing.T) {
+	c := conf
+	c.Exclude = []string{"mod/gen", `quote"d`}
+	c.Notify = []NotifyConf{{Name: "chat", URL: "https://chat", Headers: map[string]string{"X-Key": "k", "odd key": "v"}}}
+
+	for _, format := range []string{"json", "yaml", "toml"} {
+		t.Run(format, func(t *testing.T) {
+			data, err := encodeConfig(c, format)
+			assert.NoError(t, err)
+
+			path := filepath.Join(t.TempDir(), ".gotestiful"+ifelse(format == "json", "", "."+format))
+			assert.NoError(t, os.WriteFile(path, data, 0o666))
+
+			var read config
+			_, err = readConfigFile(path, &read)
+			assert.NoError(t, err)
+			assert.Equal(t, c, read)
+		})
+	}
+
+	data, _ := encodeConfig(conf, "toml")
+	assert.Contains(t, string(data), "version = 2\ncache = true\n")
+	assert.Contains(t, string(data), "\n[output]\ncolor = true\n")
+	assert.Contains(t, string(data), "\n[azure]\ncomment = false\n")
+}
+
+func TestFindProjectConfigFile(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "mod", "pkg", "inner")
+	assert.NoError(t, os.MkdirAll(sub, 0o777))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".gotestiful"), nil, 0o666))
+
+	found, err := findProjectConfigFile(sub)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, ".gotestiful"), found, "no module root, searched up to /")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "mod", "go.mod"), nil, 0o666))
+	found, err = findProjectConfigFile(sub)
+	assert.NoError(t, err)
+	assert.Equal(t, "", found, "stops at the module root")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "mod", ".gotestiful.toml"), nil, 0o666))
+	found, err = findProjectConfigFile(sub)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "mod", ".gotestiful.toml"), found)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "mod", "pkg", ".gotestiful.yaml"), nil, 0o666))
+	found, err = findProjectConfigFile(sub)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "mod", "pkg", ".gotestiful.yaml"), found, "nearest config wins")
+}
+
+func TestGetConfigLayers(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	assert.NoError(t, os.MkdirAll(filepath.Join(xdg, "gotestiful"), 0o777))
+	assert.NoError(t, os.WriteFile(filepath.Join(xdg, "gotestiful", "config.yaml"), []byte("color: false\nverbose: true\nexclude: [global]\n"), 0o666))
+
+	mod := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(mod, "go.mod"), []byte("module mod\n"), 0o666))
+	assert.NoError(t, os.WriteFile(filepath.Join(mod, ".gotestiful"), []byte(`{"version": 2, "output": {"verbose": false}, "exclude": ["mod/gen"]}`), 0o666))
+	assert.NoError(t, os.MkdirAll(filepath.Join(mod, "pkg"), 0o777))
+
+	pwd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(filepath.Join(mod, "pkg")))
+	t.Cleanup(func() { _ = os.Chdir(pwd) })
+
+	c, err := GetConfig("")
+	assert.NoError(t, err)
+	assert.False(t, c.Output.Color, "from the global config (version 1)")
+	assert.False(t, c.Output.Verbose, "project overrides global")
+	assert.Equal(t, []string{"mod/gen"}, c.Exclude)
+	assert.True(t, c.Coverage.Enabled, "default")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(xdg, "gotestiful", "config"), nil, 0o666))
+	_, err = GetConfig("")
+	assert.ErrorContains(t, err, "multiple config files found")
+}
+
+func TestConfigProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".gotestiful.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+verbose: true
+exclude: [mod/gen]
+profiles:
+  ci:
+    color: false
+    cache: false
+    junit: junit.xml
+    azure:
+      status: true
+  nested:
+    profiles: {}
+`), 0o666))
+
+	c := conf
+	c.Profiles = map[string]json.RawMessage{}
+	_, err := readConfigFile(path, &c)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, c.validateProfiles(), "invalid config profile 'nested': profiles can not be nested")
+	delete(c.Profiles, "nested")
+	assert.NoError(t, c.validateProfiles())
+
+	ci := c
+	keys, err := ci.applyProfile("ci")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"output.color", "cache", "junit", "azure.status"}, keys, "version 1 profile migrated")
+	assert.False(t, ci.Output.Color)
+	assert.False(t, ci.Cache)
+	assert.Equal(t, "junit.xml", ci.JUnit)
+	assert.True(t, ci.Azure.Status)
+	assert.True(t, ci.Output.Verbose, "base setting kept")
+	assert.Equal(t, []string{"mod/gen"}, ci.Exclude)
+
+	base := c
+	_, err = base.applyProfile("")
+	assert.NoError(t, err)
+	assert.Equal(t, c, base)
+
+	_, err = c.applyProfile("nightly")
+	assert.EqualError(t, err, "config profile 'nightly' not found (profiles: ci)")
+
+	c.Profiles["typo"] = json.RawMessage(`{"colr": false}`)
+	assert.EqualError(t, c.validateProfiles(), `invalid config profile 'typo': unknown field "colr"`)
+}
+
+func TestProfileFromArgs(t *testing.T) {
+	t.Setenv("GOTESTIFUL_PROFILE", "local")
+
+	assert.Equal(t, "ci", ProfileFromArgs([]string{"-v", "-profile", "ci", "./..."}))
+	assert.Equal(t, "ci", ProfileFromArgs([]string{"-junit", "out.xml", "--profile=ci"}))
+	assert.Equal(t, "local", ProfileFromArgs([]string{"-v", "--", "-profile", "ci"}))
+	assert.Equal(t, "local", ProfileFromArgs(nil))
+}
+
+func TestConfigApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"GOTESTIFUL_COVER":                 "false",
+		"GOTESTIFUL_VERBOSE":               "true",
+		"GOTESTIFUL_OUTPUT_VERBOSE":        "false",
+		"GOTESTIFUL_EXCLUDE":               "mod/a, mod/b,",
+		"GOTESTIFUL_SUMMARY_JSON":          "summary.json",
+		"GOTESTIFUL_AZURE_INLINE_COMMENTS": "1",
+		"GOTESTIFUL_PUBLISH_ATTEMPTS":      "5",
+		"GOTESTIFUL_NOTIFY":                `[{"url": "https://chat"}]`,
+		"GOTESTIFUL_JUNIT":                 "",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		val, ok := env[key]
+		return val, ok
+	}
+
+	c := conf
+	c.JUnit = "junit.xml"
+	keys, err := c.applyEnv(lookupEnv)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"output.verbose", "coverage.enabled", "exclude", "summaryJson", "junit", "notify", "azure.inlineComments", "publish.attempts"}, keys)
+	assert.False(t, c.Coverage.Enabled, "version 1 variable")
+	assert.False(t, c.Output.Verbose, "the current variable wins")
+	assert.True(t, c.Output.Color, "not set")
+	assert.Equal(t, []string{"mod/a", "mod/b"}, c.Exclude)
+	assert.Equal(t, "summary.json", c.SummaryJSON)
+	assert.True(t, c.Azure.InlineComments)
+	assert.Equal(t, 5, c.Publish.Attempts)
+	assert.Equal(t, []NotifyConf{{URL: "https://chat"}}, c.Notify)
+	assert.Equal(t, "", c.JUnit, "set empty")
+
+	env = map[string]string{"GOTESTIFUL_CACHE": "nope"}
+	_, err = c.applyEnv(lookupEnv)
+	assert.EqualError(t, err, `invalid value "nope" for GOTESTIFUL_CACHE: parse error`)
+
+	env = map[string]string{"GOTESTIFUL_PUBLISH_ATTEMPTS": "3x"}
+	_, err = c.applyEnv(lookupEnv)
+	assert.EqualError(t, err, `invalid value "3x" for GOTESTIFUL_PUBLISH_ATTEMPTS: parse error`)
+}
+
+func TestConfigEnvName(t *testing.T) {
+	assert.Equal(t, "GOTESTIFUL_COVERAGE_PROFILE", configEnvName("coverage.profile"))
+	assert.Equal(t, "GOTESTIFUL_COVER_PROFILE", configEnvName("coverProfile"))
+	assert.Equal(t, "GOTESTIFUL_AZURE_INLINE_COMMENTS", configEnvName("azure.inlineComments"))
+	assert.Equal(t, "GOTESTIFUL_JUNIT", configEnvName("junit"))
+}
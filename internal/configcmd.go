@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// configSources holds the source of each config key set eg. 'project /mod/.gotestiful' or 'env GOTESTIFUL_COVERAGE_ENABLED', unset keys are defaults
+type configSources map[string]string
+
+func (cs configSources) set(keys []string, source string) {
+	for _, key := range keys {
+		cs[key] = source
+	}
+}
+
+// source returns the source of the 'key' or the one of its parent eg. 'azure' set as a whole by a profile
+func (cs configSources) source(key string) string {
+	for {
+		if source, ok := cs[key]; ok {
+			return source
+		}
+
+		dot := strings.LastIndex(key, ".")
+		if dot < 0 {
+			return "default"
+		}
+		key = key[:dot]
+	}
+}
+
+// configFlags maps the flags to their config keys
+var configFlags = map[string]string{
+	"color":               "output.color",
+	"cache":               "cache",
+	"cover":               "coverage.enabled",
+	"report":              "coverage.report",
+	"coverprofile":        "coverage.profile",
+	"v":                   "output.verbose",
+	"listignored":         "output.listIgnored",
+	"skipempty":           "output.skipEmpty",
+	"listempty":           "output.listEmpty",
+	"fullCoverage":        "coverage.full",
+	"testoutput":          "testOutput",
+	"junit":               "junit",
+	"cobertura":           "cobertura",
+	"summary-json":        "summaryJson",
+	"template":            "template",
+	"template-output":     "templateOutput",
+	"comment-template":    "commentTemplate",
+	"baseline":            "baseline",
+	"azureComment":        "azure.comment",
+	"azureInlineComments": "azure.inlineComments",
+	"githubComment":       "github.comment",
+	"githubAPIURL":        "github.apiUrl",
+	"gitlabNote":          "gitlab.comment",
+	"publisher":           "publish.provider",
+}
+
+// validate checks the settings that can't be checked while decoding: the exclude regexes and the conflicting options.
+// The errors name the source of the offending keys.
+func (c config) validate(sources configSources) error {
+	errs := []string{}
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, sf("%s: %s (%s)", key, sf(format, args...), sources.source(key)))
+	}
+
+	for key, rules := range map[string][]string{"include": c.Include, "exclude": c.Exclude} {
+		for _, rule := range rules {
+			if _, err := parsePkgPattern(rule, ""); err != nil {
+				fail(key, "invalid regex %q: %s", rule, strings.TrimPrefix(errors.Unwrap(err).Error(), "error parsing regexp: "))
+			}
+		}
+	}
+
+	for _, rule := range mapSortedKeys(c.Packages) {
+		key := "packages." + rule
+		if _, err := parsePkgPattern(rule, ""); err != nil {
+			fail(key, "invalid regex %q: %s", rule, strings.TrimPrefix(errors.Unwrap(err).Error(), "error parsing regexp: "))
+		}
+		if err := c.Packages[rule].validate(); err != nil {
+			fail(key, "%s", err)
+		}
+		if c.Packages[rule].Coverage > 0 && !c.Coverage.Enabled {
+			fail(key, "coverage requires coverage.enabled, disabled by %s", sources.source("coverage.enabled"))
+		}
+	}
+
+	if c.TemplateOutput != "" && c.Template == "" {
+		fail("templateOutput", "requires template")
+	}
+
+	for i, hook := range c.Notify {
+		if hook.OnCoverageDrop && c.Baseline == "" {
+			fail("notify", "hook %d onCoverageDrop requires baseline", i+1)
+		}
+	}
+
+	if err := c.Publish.validate(); err != nil {
+		fail("publish.timeout", "%s", strings.TrimPrefix(err.Error(), "invalid publish timeout: "))
+	}
+	if c.Publish.Provider != "" && !slices.Contains(publishProviders, c.Publish.Provider) {
+		fail("publish.provider", "unknown provider %q (%s)", c.Publish.Provider, strings.Join(publishProviders, ", "))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	slices.Sort(errs)
+	return errors.New("invalid config:\n  " + strings.Join(errs, "\n  "))
+}
+
+// resolveConfig layers the config sources and the command line 'flags', parsed by the flag package already
+func resolveConfig(profile string, flags map[string]string) (config, configSources, error) {
+	c, sources, err := loadConfig(profile)
+	if err != nil {
+		return config{}, nil, err
+	}
+
+	err = c.applyFlags(flags, sources)
+	if err != nil {
+		return config{}, nil, err
+	}
+
+	return c, sources, nil
+}
+
+// ValidateConfig checks the resolved settings, with the command line 'flags' applied, so a flag can fix a config value
+func ValidateConfig(profile string, flags map[string]string) error {
+	c, sources, err := resolveConfig(profile, flags)
+	if err != nil {
+		return err
+	}
+	return c.validate(sources)
+}
+
+// ShowConfig prints the resolved config and the source of each value: default, global or project file, profile, env or flag.
+// 'flags' are the flags set in the command line. The config is validated after printing.
+func ShowConfig(profile string, flags map[string]string) error {
+	c, sources, err := resolveConfig(profile, flags)
+	if err != nil {
+		return err
+	}
+
+	width := 0
+	walkConfigFields(reflect.ValueOf(&c).Elem(), "", func(key string, _ reflect.Value) {
+		width = ifelse(len(key) > width, len(key), width)
+	})
+
+	fmt.Println()
+	if profile != "" {
+		fmt.Println(shColor("white:bold", "profile:"), profile)
+	}
+	walkConfigFields(reflect.ValueOf(&c).Elem(), "", func(key string, field reflect.Value) {
+		val, _ := json.Marshal(field.Interface())
+		source := sources.source(key)
+		fmt.Println(sf("%-*s", width, key), shColor(ifelse(source == "default", "gray", "white"), string(val)), shColor("gray", "("+source+")"))
+	})
+	fmt.Println()
+
+	return c.validate(sources)
+}
+
+// applyFlags sets the config keys of the command line 'flags', parsed by the flag package already
+func (c *config) applyFlags(flags map[string]string, sources configSources) error {
+	fields := map[string]reflect.Value{}
+	walkConfigFields(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+		fields[key] = field
+	})
+
+	for _, name := range mapSortedKeys(flags) {
+		key, ok := configFlags[name]
+		if !ok {
+			continue
+		}
+
+		err := setConfigField(fields[key], flags[name])
+		if err != nil {
+			return fmt.Errorf("invalid value %q for flag -%s: %w", flags[name], name, err)
+		}
+		sources[key] = "flag -" + name
+	}
+
+	return nil
+}
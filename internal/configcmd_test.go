@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigSources(t *testing.T) {
+	sources := configSources{}
+	sources.set([]string{"cache", "azure"}, "profile ci")
+	sources["azure.comment"] = "env GOTESTIFUL_AZURE_COMMENT"
+
+	assert.Equal(t, "profile ci", sources.source("cache"))
+	assert.Equal(t, "profile ci", sources.source("azure.url"), "set by the parent key")
+	assert.Equal(t, "env GOTESTIFUL_AZURE_COMMENT", sources.source("azure.comment"))
+	assert.Equal(t, "default", sources.source("cover"))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, conf.validate(configSources{}))
+
+	c := conf
+	c.Coverage.Enabled = false
+	c.Coverage.Report = true // go test collects the coverage of -coverprofile anyway
+	c.Exclude = []string{"mod/(gen", "mod/ok"}
+	c.TemplateOutput = "out.md"
+	c.Notify = []NotifyConf{{URL: "https://chat", OnCoverageDrop: true}}
+	c.Publish = PublishConf{Timeout: "soon", Provider: "gerrit"}
+	c.Packages = map[string]PackageConf{"./db/...": {Timeout: "10", Coverage: 50}, "mod/(api": {}}
+
+	sources := configSources{"coverage.enabled": "flag -cover", "coverage.report": "project /mod/.gotestiful"}
+	assert.EqualError(t, c.validate(sources), `invalid config:
+  exclude: invalid regex "mod/(gen": missing closing ): `+"`^mod/(gen`"+` (default)
+  notify: hook 1 onCoverageDrop requires baseline (default)
+  packages../db/...: coverage requires coverage.enabled, disabled by flag -cover (default)
+  packages../db/...: invalid timeout "10" (default)
+  packages.mod/(api: invalid regex "mod/(api": missing closing ): `+"`^mod/(api`"+` (default)
+  publish.provider: unknown provider "gerrit" (azure, bitbucket, gitea, github, gitlab) (default)
+  publish.timeout: time: invalid duration "soon" (default)
+  templateOutput: requires template (default)`)
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	mod := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(mod, "go.mod"), []byte("module mod\n"), 0o666))
+	assert.NoError(t, os.WriteFile(filepath.Join(mod, ".gotestiful"), []byte(`{"cover": false, "report": true, "templateOutput": "out.md"}`), 0o666))
+
+	pwd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(mod))
+	t.Cleanup(func() { _ = os.Chdir(pwd) })
+
+	_, err := GetConfig("")
+	assert.NoError(t, err, "checked once the flags are applied")
+	assert.ErrorContains(t, ValidateConfig("", map[string]string{}), "templateOutput: requires template")
+	assert.NoError(t, ValidateConfig("", map[string]string{"template": "summary.tmpl"}), "a flag fixes the config")
+}
+
+func TestConfigApplyFlags(t *testing.T) {
+	c := conf
+	sources := configSources{"cache": "project /mod/.gotestiful"}
+
+	assert.NoError(t, c.applyFlags(map[string]string{"cache": "false", "v": "true", "azureComment": "true", "version": "false"}, sources))
+	assert.False(t, c.Cache)
+	assert.True(t, c.Output.Verbose)
+	assert.True(t, c.Azure.Comment)
+	assert.Equal(t, configSources{"cache": "flag -cache", "output.verbose": "flag -v", "azure.comment": "flag -azureComment"}, sources)
+
+	assert.EqualError(t, c.applyFlags(map[string]string{"cover": "maybe"}, sources), `invalid value "maybe" for flag -cover: parse error`)
+}
@@ -2,40 +2,162 @@ package internal
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
+	"strings"
 )
 
-func excludePackages(packages, excludes []string) ([]string, []string, error) {
-	if len(excludes) == 0 {
-		return packages, nil, nil
+// pkgPattern is an include/exclude rule. Patterns are either:
+//   - directory relative eg. './internal/gen/...' (the package and its subpackages) or './internal/gen', relative to the module root
+//   - globs if they have a '**' wildcard or a 'glob:' prefix eg. '**/mocks' or 'glob:mod/*/gen' ('*' matches within a path segment, '**' any segments)
+//   - regexes matching the start of the import path eg. 'mod/gen', 'mod/gen*' or '.*/mocks', as the entries always were
+//
+// A '!' prefix negates the rule, eg. to re-include a package a broader rule excluded.
+type pkgPattern struct {
+	rule   string // as written, shown in the ignored packages list
+	negate bool
+	regex  *regexp.Regexp // import path match
+	dir    string         // or absolute package dir match
+	subDir bool           // dir pattern ending with '/...'
+}
+
+func parsePkgPattern(rule, root string) (pkgPattern, error) {
+	p := pkgPattern{rule: rule, negate: strings.HasPrefix(rule, "!")}
+	pattern := strings.TrimPrefix(rule, "!")
+
+	switch {
+	case pattern == "." || pattern == "./..." || strings.HasPrefix(pattern, "./") || strings.HasPrefix(pattern, "../"):
+		p.subDir = strings.HasSuffix(pattern, "/...")
+		p.dir = filepath.Join(root, strings.TrimSuffix(pattern, "/..."))
+
+	case isGlob(pattern):
+		p.regex = regexp.MustCompile(globToRegex(strings.TrimPrefix(pattern, globPrefix)))
+
+	default:
+		regex, err := regexp.Compile("^" + pattern)
+		if err != nil {
+			return p, fmt.Errorf("cannot compile regex %q: %w", pattern, err)
+		}
+		p.regex = regex
+	}
+
+	return p, nil
+}
+
+func (p pkgPattern) match(pkg Package) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(pkg.ImportPath)
+	}
+	if pkg.Dir == "" {
+		return false
+	}
+	return pkg.Dir == p.dir || (p.subDir && strings.HasPrefix(pkg.Dir, p.dir+string(filepath.Separator)))
+}
+
+// globPrefix marks a glob without '**' eg. 'glob:mod/*/gen', else 'mod/*/gen' is a regex like the entries have always been
+const globPrefix = "glob:"
+
+// isGlob tells globs from regexes. '**' is not a valid regex so those entries could not have been regexes.
+func isGlob(pattern string) bool {
+	return strings.HasPrefix(pattern, globPrefix) || strings.Contains(pattern, "**")
+}
+
+// globToRegex converts a glob to a regex matching the whole import path.
+// '**' matches any path segments (including none), '*' and '?' match within a segment.
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("(?:/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			sb.WriteString("[^/]*")
+		case glob[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
 	}
 
-	excludeRegexs := make([]*regexp.Regexp, 0, len(excludes))
-	for _, exclude := range excludes {
-		if exclude == "" {
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// matchRules evaluates the 'rules' in order, the last matching one wins (like .gitignore).
+// Returns if the package is matched and by which rule, empty if none matched.
+func matchRules(rules []pkgPattern, pkg Package) (bool, string) {
+	matched, by := false, ""
+	for _, r := range rules {
+		if r.match(pkg) {
+			matched, by = !r.negate, r.rule
+		}
+	}
+	return matched, by
+}
+
+func parsePkgPatterns(rules []string, root string) ([]pkgPattern, error) {
+	patterns := make([]pkgPattern, 0, len(rules))
+	for _, rule := range rules {
+		if strings.TrimPrefix(rule, "!") == "" {
 			// this would catch all, probably not the intention
 			continue
 		}
-		regex, err := regexp.Compile("^" + exclude)
+		p, err := parsePkgPattern(rule, root)
 		if err != nil {
-			return nil, nil, fmt.Errorf("cannot compile regex %q: %+v", exclude, regex)
+			return nil, err
 		}
-		excludeRegexs = append(excludeRegexs, regex)
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// excludePackages selects the packages matching the 'includes' (all if empty) and not matching the 'excludes'.
+// 'pkgsMap' has the packages dirs for the directory patterns, relative to the module 'root'.
+// Returns the included and excluded packages, and the rule that excluded each one eg. 'exclude mod/gen'.
+func excludePackages(packages []string, pkgsMap map[string]Package, includes, excludes []string, root string) ([]string, []string, map[string]string, error) {
+	rules := map[string]string{}
+	if len(excludes) == 0 && len(includes) == 0 {
+		return packages, nil, rules, nil
+	}
+
+	includeRules, err := parsePkgPatterns(includes, root)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	excludeRules, err := parsePkgPatterns(excludes, root)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	var included, excluded []string
 	for _, pkg := range packages {
-		isIncluded := true
-		for _, regex := range excludeRegexs {
-			if regex.MatchString(pkg) {
-				isIncluded = false
+		p := pkgsMap[pkg]
+		p.ImportPath = pkg
+
+		if len(includeRules) > 0 {
+			if in, by := matchRules(includeRules, p); !in {
+				excluded = append(excluded, pkg)
+				rules[pkg] = ifelse(by == "", "not included", "include "+by)
+				continue
 			}
 		}
-		if isIncluded {
-			included = append(included, pkg)
-		} else {
+
+		if out, by := matchRules(excludeRules, p); out {
 			excluded = append(excluded, pkg)
+			rules[pkg] = "exclude " + by
+			continue
 		}
+
+		included = append(included, pkg)
 	}
-	return included, excluded, nil
+	return included, excluded, rules, nil
 }
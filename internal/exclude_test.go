@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -42,6 +43,30 @@ func TestExclude(t *testing.T) {
 		excluded:         []string{".*/package"},
 		expectedIncluded: []string{"zero", "one/other", "two/other", "three"},
 		expectedIgnored:  []string{"one/package", "two/package"},
+	}, {
+		name:             "glob",
+		packages:         []string{"mod/a/mocks", "mod/mocks", "mod/a/mocks/sub", "mod/gen/a/b", "mod/gen", "mod/generated"},
+		excluded:         []string{"**/mocks", "mod/gen/**"},
+		expectedIncluded: []string{"mod/a/mocks/sub", "mod/generated"},
+		expectedIgnored:  []string{"mod/a/mocks", "mod/mocks", "mod/gen/a/b", "mod/gen"},
+	}, {
+		name:             "single segment glob",
+		packages:         []string{"mod/a/gen", "mod/a/b/gen", "mod/gen"},
+		excluded:         []string{"glob:mod/*/gen"},
+		expectedIncluded: []string{"mod/a/b/gen", "mod/gen"},
+		expectedIgnored:  []string{"mod/a/gen"},
+	}, {
+		name:             "star is a regex without the glob prefix",
+		packages:         []string{"mod/gen", "mod/gen/sub", "mod/generated/x", "mod/api"},
+		excluded:         []string{"mod/gen*"},
+		expectedIncluded: []string{"mod/api"},
+		expectedIgnored:  []string{"mod/gen", "mod/gen/sub", "mod/generated/x"},
+	}, {
+		name:             "negation re-includes",
+		packages:         []string{"mod/gen/a", "mod/gen/keep", "mod/gen/keep/sub", "mod/b"},
+		excluded:         []string{"mod/gen", "!mod/gen/keep$"},
+		expectedIncluded: []string{"mod/gen/keep", "mod/b"},
+		expectedIgnored:  []string{"mod/gen/a", "mod/gen/keep/sub"},
 	}, {
 		name:             "empty excludes - empty string ignored",
 		packages:         []string{"one", "two", "three"},
@@ -54,10 +79,55 @@ func TestExclude(t *testing.T) {
 		tst := tst
 		t.Run(tst.name, func(t *testing.T) {
 			t.Parallel()
-			included, ignored, err := excludePackages(tst.packages, tst.excluded)
+			included, ignored, _, err := excludePackages(tst.packages, nil, nil, tst.excluded, "")
 			assert.NoError(t, err)
 			assert.Equal(t, tst.expectedIncluded, included)
 			assert.Equal(t, tst.expectedIgnored, ignored)
 		})
 	}
 }
+
+func TestIncludePackages(t *testing.T) {
+	t.Parallel()
+
+	root := filepath.FromSlash("/src/mod")
+	pkgsMap := map[string]Package{
+		"mod":                  {Dir: root},
+		"mod/internal/gen":     {Dir: filepath.Join(root, "internal", "gen")},
+		"mod/internal/gen/sub": {Dir: filepath.Join(root, "internal", "gen", "sub")},
+		"mod/internal/api":     {Dir: filepath.Join(root, "internal", "api")},
+		"mod/cmd":              {Dir: filepath.Join(root, "cmd")},
+	}
+	packages := []string{"mod", "mod/internal/gen", "mod/internal/gen/sub", "mod/internal/api", "mod/cmd"}
+
+	included, ignored, rules, err := excludePackages(packages, pkgsMap, []string{"./internal/...", "!mod/internal/api"}, []string{"./internal/gen"}, root)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mod/internal/gen/sub"}, included)
+	assert.Equal(t, []string{"mod", "mod/internal/gen", "mod/internal/api", "mod/cmd"}, ignored)
+	assert.Equal(t, map[string]string{
+		"mod":              "not included",
+		"mod/internal/gen": "exclude ./internal/gen",
+		"mod/internal/api": "include !mod/internal/api",
+		"mod/cmd":          "not included",
+	}, rules)
+
+	_, _, _, err = excludePackages(packages, pkgsMap, []string{"mod/(api"}, nil, root)
+	assert.ErrorContains(t, err, `cannot compile regex "mod/(api"`)
+}
+
+func TestGlobToRegex(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, isGlob("**/mocks"))
+	assert.True(t, isGlob("glob:mod/*/gen"))
+	assert.False(t, isGlob("mod/*/gen"))
+	assert.False(t, isGlob("mod/gen*"))
+	assert.False(t, isGlob(".*/package"))
+	assert.False(t, isGlob("mod/(a|b)*"))
+	assert.False(t, isGlob("mod/gen"))
+
+	assert.Equal(t, `^(?:.*/)?mocks$`, globToRegex("**/mocks"))
+	assert.Equal(t, `^mod/gen(?:/.*)?$`, globToRegex("mod/gen/**"))
+	assert.Equal(t, `^mod/[^/]*_test/[^/]$`, globToRegex("mod/*_test/?"))
+	assert.Equal(t, `^mod/(?:.*/)?gen\.v1$`, globToRegex("mod/**/gen.v1"))
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 func getPWD() (string, error) {
@@ -35,6 +36,38 @@ func readFile(filePath string) ([]byte, error) {
 	return fileBytes, nil
 }
 
+// relPath returns the path of 'file' (in package dir 'pkgDir') relative to 'root' (or the current directory if empty)
+func relPath(root, pkgDir, file string) string {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(pkgDir, file)
+	}
+
+	if root == "" {
+		root, _ = getPWD()
+	}
+
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// moduleRoot returns the closest directory from 'dir' up holding a go.mod or go.work, 'dir' itself if there's none
+func moduleRoot(dir string) string {
+	for d := dir; ; {
+		if fileExists(filepath.Join(d, "go.mod")) || fileExists(filepath.Join(d, "go.work")) {
+			return d
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
 func deleteFiles(files *[]string) {
 	for _, f := range *files {
 		os.Remove(f)
@@ -1,6 +1,10 @@
 package internal
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // sf is short-hand for string format and calls fmt.Sprintf if arguments are passed
 func sf(str string, args ...any) string {
@@ -30,3 +34,17 @@ func ifelse[T any](cond bool, trueVal T, falseVal T) T {
 	}
 	return falseVal
 }
+
+// joinErrors combines the 'errs' into one error, one per line, nil if there are none (errors.Join needs Go 1.20)
+func joinErrors(errs []error) error {
+	msgs := []string{}
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
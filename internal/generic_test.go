@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -80,3 +81,9 @@ func TestIfelse(t *testing.T) {
 		assert.Equal(t, expected, actual)
 	})
 }
+
+func TestJoinErrors(t *testing.T) {
+	assert.NoError(t, joinErrors(nil))
+	assert.NoError(t, joinErrors([]error{nil, nil}))
+	assert.EqualError(t, joinErrors([]error{errors.New("one"), nil, errors.New("two")}), "one\ntwo")
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// GiteaConf holds the Gitea pull request settings, set in the config 'gitea' section.
+type GiteaConf struct {
+	PublishFeatures
+	URL string `json:"url"` // server url eg. https://gitea.example.com, defaults to GITHUB_SERVER_URL in Gitea Actions
+
+	Repository  string `json:"-"` // owner/repo
+	PullRequest int    `json:"-"`
+	Commit      string `json:"-"`
+	BuildURL    string `json:"-"` // link of the commit status
+	Token       string `json:"-"` // GITEA_TOKEN
+	Actions     bool   `json:"-"` // running in Gitea Actions
+	Workspace   string `json:"-"` // repository root, review comment paths are relative to it
+
+	Publish PublishConf `json:"-"`
+}
+
+// GiteaConfFromEnv completes the 'conf' settings with the Gitea Actions variables, which follow the GitHub Actions ones
+func GiteaConfFromEnv(conf GiteaConf) GiteaConf {
+	conf.Actions = os.Getenv("GITEA_ACTIONS") == "true"
+	if conf.Actions {
+		conf.URL = zvfb(conf.URL, os.Getenv("GITHUB_SERVER_URL"))
+		conf.Repository = os.Getenv("GITHUB_REPOSITORY")
+		conf.PullRequest = githubPullRequestFromRef(os.Getenv("GITHUB_REF"))
+		conf.Commit = os.Getenv("GITHUB_SHA")
+		conf.Workspace = os.Getenv("GITHUB_WORKSPACE")
+		if conf.URL != "" && conf.Repository != "" && os.Getenv("GITHUB_RUN_NUMBER") != "" {
+			conf.BuildURL = sf("%s/%s/actions/runs/%s", strings.TrimRight(conf.URL, "/"), conf.Repository, os.Getenv("GITHUB_RUN_NUMBER"))
+		}
+	}
+	conf.Token = os.Getenv("GITEA_TOKEN")
+	return conf
+}
+
+type giteaComment struct {
+	ID   int64  `json:"id,omitempty"`
+	Body string `json:"body"`
+}
+
+// giteaReview is a pull request review, the inline comments are posted as one review
+type giteaReview struct {
+	ID       int64                `json:"id,omitempty"`
+	Body     string               `json:"body"`
+	Event    string               `json:"event,omitempty"`
+	CommitID string               `json:"commit_id,omitempty"`
+	Comments []giteaReviewComment `json:"comments,omitempty"`
+}
+
+type giteaReviewComment struct {
+	Path        string `json:"path"`
+	Body        string `json:"body"`
+	NewPosition int    `json:"new_position"`
+}
+
+func (gt GiteaConf) Features() PublishFeatures {
+	return gt.PublishFeatures
+}
+
+func (gt GiteaConf) PublishComment(body string, failed bool) error {
+	comment := giteaComment{Body: commentMarker + "\n" + body}
+
+	var comments []giteaComment
+	err := gt.request(http.MethodGet, gt.repoURL()+sf("/issues/%d/comments", gt.PullRequest), nil, &comments)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		if strings.Contains(c.Body, commentMarker) {
+			return gt.request(http.MethodPatch, gt.repoURL()+sf("/issues/comments/%d", c.ID), comment, nil)
+		}
+	}
+
+	return gt.request(http.MethodPost, gt.repoURL()+sf("/issues/%d/comments", gt.PullRequest), comment, nil)
+}
+
+// PublishAnnotations publishes a review with a comment at the '_test.go' line of each failure.
+// The review of a previous run is deleted so only the current failures are shown.
+func (gt GiteaConf) PublishAnnotations(annotations []Annotation) error {
+	reviewsURL := gt.repoURL() + sf("/pulls/%d/reviews", gt.PullRequest)
+
+	var reviews []giteaReview
+	err := gt.request(http.MethodGet, reviewsURL, nil, &reviews)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reviews {
+		if !strings.Contains(r.Body, failureMarker) {
+			continue
+		}
+
+		err = gt.request(http.MethodDelete, sf("%s/%d", reviewsURL, r.ID), nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	review := giteaReview{
+		Body:     failureMarker + "\n" + sf("❌ %d test failure locations", len(annotations)),
+		Event:    "COMMENT",
+		CommitID: gt.Commit,
+	}
+	for _, a := range annotations {
+		review.Comments = append(review.Comments, giteaReviewComment{Path: relPath(gt.Workspace, "", a.File), Body: a.Body, NewPosition: a.Line})
+	}
+
+	return gt.request(http.MethodPost, reviewsURL, review, nil)
+}
+
+// PublishStatus sets the commit status of the pull request head
+func (gt GiteaConf) PublishStatus(failed bool, description string) error {
+	if gt.Commit == "" {
+		return fmt.Errorf("gitea: the commit is required for the status (GITHUB_SHA)")
+	}
+
+	return gt.request(http.MethodPost, gt.repoURL()+"/statuses/"+gt.Commit, map[string]string{
+		"state":       ifelse(failed, "failure", "success"),
+		"context":     "gotestiful",
+		"description": description,
+		"target_url":  gt.BuildURL,
+	}, nil)
+}
+
+func (gt GiteaConf) Ready() error {
+	if gt.URL == "" || gt.Repository == "" || gt.PullRequest == 0 || gt.Token == "" {
+		return fmt.Errorf("gitea: url, repository, pull request and token are required (GITHUB_SERVER_URL, GITHUB_REPOSITORY, GITHUB_REF, GITEA_TOKEN)")
+	}
+	return nil
+}
+
+func (gt GiteaConf) repoURL() string {
+	return sf("%s/api/v1/repos/%s", strings.TrimRight(gt.URL, "/"), gt.Repository)
+}
+
+func (gt GiteaConf) request(method, reqURL string, body, out any) error {
+	return apiClient{
+		name:    "gitea",
+		headers: map[string]string{"Authorization": "token " + gt.Token},
+		conf:    gt.Publish,
+	}.request(method, reqURL, body, out)
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGiteaConfFromEnv(t *testing.T) {
+	t.Setenv("GITEA_ACTIONS", "true")
+	t.Setenv("GITHUB_SERVER_URL", "https://gitea.example.com")
+	t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+	t.Setenv("GITHUB_REF", "refs/pull/9/head")
+	t.Setenv("GITHUB_SHA", "abc")
+	t.Setenv("GITHUB_WORKSPACE", "/workspace/owner/repo")
+	t.Setenv("GITHUB_RUN_NUMBER", "4")
+	t.Setenv("GITEA_TOKEN", "tkn")
+
+	assert.Equal(t, GiteaConf{
+		URL:         "https://gitea.example.com",
+		Repository:  "owner/repo",
+		PullRequest: 9,
+		Commit:      "abc",
+		BuildURL:    "https://gitea.example.com/owner/repo/actions/runs/4",
+		Token:       "tkn",
+		Actions:     true,
+		Workspace:   "/workspace/owner/repo",
+	}, GiteaConfFromEnv(GiteaConf{}))
+
+	t.Setenv("GITEA_ACTIONS", "")
+	assert.Equal(t, GiteaConf{URL: "https://git.example.com", Token: "tkn"}, GiteaConfFromEnv(GiteaConf{URL: "https://git.example.com"}))
+}
+
+func TestGiteaPublish(t *testing.T) {
+	type request struct {
+		Method, Path, Auth, Body string
+	}
+
+	stub := func(responses map[string]string) (*httptest.Server, *[]request) {
+		requests := []request{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests = append(requests, request{r.Method, r.URL.Path, r.Header.Get("Authorization"), string(body)})
+			_, _ = w.Write([]byte(zvfb(responses[r.Method+" "+r.URL.Path], "{}")))
+		}))
+		return server, &requests
+	}
+
+	conf := func(serverURL string) GiteaConf {
+		return GiteaConf{URL: serverURL, Repository: "owner/repo", PullRequest: 9, Commit: "abc", Token: "tkn", Workspace: "/ws"}
+	}
+
+	t.Run("missing settings", func(t *testing.T) {
+		assert.ErrorContains(t, GiteaConf{URL: "http://localhost"}.Ready(), "gitea: url, repository, pull request and token are required")
+	})
+
+	t.Run("updates own comment", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"GET /api/v1/repos/owner/repo/issues/9/comments": `[{"id": 1, "body": "someone else"}, {"id": 5, "body": "` + commentMarker + `"}]`,
+		})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishComment("Total coverage is 75.00%", false))
+		body, _ := json.Marshal(giteaComment{Body: commentMarker + "\nTotal coverage is 75.00%"})
+		assert.Equal(t, []request{
+			{http.MethodGet, "/api/v1/repos/owner/repo/issues/9/comments", "token tkn", ""},
+			{http.MethodPatch, "/api/v1/repos/owner/repo/issues/comments/5", "token tkn", string(body)},
+		}, *requests)
+	})
+
+	t.Run("creates comment", func(t *testing.T) {
+		server, requests := stub(map[string]string{"GET /api/v1/repos/owner/repo/issues/9/comments": `[]`})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishComment("Total coverage is 75.00%", false))
+		assert.Len(t, *requests, 2)
+		assert.Equal(t, http.MethodPost, (*requests)[1].Method)
+		assert.Equal(t, "/api/v1/repos/owner/repo/issues/9/comments", (*requests)[1].Path)
+	})
+
+	t.Run("replaces failures review", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"GET /api/v1/repos/owner/repo/pulls/9/reviews": `[{"id": 2, "body": "LGTM"}, {"id": 3, "body": "` + failureMarker + `"}]`,
+		})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishAnnotations([]Annotation{{File: "/ws/pkg/a_test.go", Line: 12, Body: "want 1"}}))
+		review, _ := json.Marshal(giteaReview{
+			Body:     failureMarker + "\n❌ 1 test failure locations",
+			Event:    "COMMENT",
+			CommitID: "abc",
+			Comments: []giteaReviewComment{{Path: "pkg/a_test.go", Body: "want 1", NewPosition: 12}},
+		})
+		assert.Equal(t, []request{
+			{http.MethodGet, "/api/v1/repos/owner/repo/pulls/9/reviews", "token tkn", ""},
+			{http.MethodDelete, "/api/v1/repos/owner/repo/pulls/9/reviews/3", "token tkn", ""},
+			{http.MethodPost, "/api/v1/repos/owner/repo/pulls/9/reviews", "token tkn", string(review)},
+		}, *requests)
+
+		*requests = (*requests)[:0]
+		assert.NoError(t, conf(server.URL).PublishAnnotations(nil))
+		assert.Len(t, *requests, 2, "no review without failures")
+	})
+
+	t.Run("status", func(t *testing.T) {
+		server, requests := stub(nil)
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishStatus(true, "1 tests failed"))
+		assert.Equal(t, []request{
+			{http.MethodPost, "/api/v1/repos/owner/repo/statuses/abc", "token tkn", `{"context":"gotestiful","description":"1 tests failed","state":"failure","target_url":""}`},
+		}, *requests)
+	})
+}
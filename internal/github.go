@@ -0,0 +1,395 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const githubDefaultAPIURL = "https://api.github.com"
+
+// GitHubConf holds the GitHub Actions and pull request settings, set in the config 'github' section.
+type GitHubConf struct {
+	PublishFeatures
+	APIURL string `json:"apiUrl"` // REST API base url eg. https://github.example.com/api/v3, defaults to GITHUB_API_URL
+
+	Actions     bool   `json:"-"` // running in GitHub Actions (annotations and output groups)
+	Workspace   string `json:"-"` // repository root, annotation and review comment paths are relative to it
+	SummaryPath string `json:"-"` // job summary markdown file
+
+	Repository  string `json:"-"` // owner/repo
+	PullRequest int    `json:"-"`
+	Commit      string `json:"-"` // pull request head, the review comments and status are set on it
+	BuildURL    string `json:"-"` // link of the commit status
+	Token       string `json:"-"` // GITHUB_TOKEN
+
+	Publish PublishConf `json:"-"`
+}
+
+// GitHubConfFromEnv completes the 'conf' settings with GitHub Actions and the pull request details from the runner environment variables
+func GitHubConfFromEnv(conf GitHubConf) GitHubConf {
+	conf.Actions = os.Getenv("GITHUB_ACTIONS") == "true"
+	conf.Workspace = os.Getenv("GITHUB_WORKSPACE")
+	conf.SummaryPath = os.Getenv("GITHUB_STEP_SUMMARY")
+	conf.APIURL = zvfb(conf.APIURL, zvfb(os.Getenv("GITHUB_API_URL"), githubDefaultAPIURL))
+	conf.Repository = os.Getenv("GITHUB_REPOSITORY")
+	conf.PullRequest = githubPullRequestFromRef(os.Getenv("GITHUB_REF"))
+	conf.Commit = zvfb(githubEventHeadSHA(os.Getenv("GITHUB_EVENT_PATH")), os.Getenv("GITHUB_SHA"))
+	conf.Token = os.Getenv("GITHUB_TOKEN")
+	if server := os.Getenv("GITHUB_SERVER_URL"); server != "" && conf.Repository != "" && os.Getenv("GITHUB_RUN_ID") != "" {
+		conf.BuildURL = sf("%s/%s/actions/runs/%s", strings.TrimRight(server, "/"), conf.Repository, os.Getenv("GITHUB_RUN_ID"))
+	}
+	return conf
+}
+
+// githubEventHeadSHA reads the pull request head commit from the workflow event payload.
+// GITHUB_SHA is the merge commit on pull request events, which the review comments can't be set on.
+func githubEventHeadSHA(eventPath string) string {
+	if eventPath == "" {
+		return ""
+	}
+	data, err := readFile(eventPath)
+	if err != nil {
+		return ""
+	}
+
+	var event struct {
+		PullRequest struct {
+			Head struct {
+				SHA string `json:"sha"`
+			} `json:"head"`
+		} `json:"pull_request"`
+	}
+	_ = json.Unmarshal(data, &event)
+	return event.PullRequest.Head.SHA
+}
+
+var regexGitHubPullRef = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+// githubPullRequestFromRef gets the pull request number from a ref eg. 'refs/pull/123/merge'
+func githubPullRequestFromRef(ref string) int {
+	match := regexGitHubPullRef.FindStringSubmatch(ref)
+	if match == nil {
+		return 0
+	}
+	pr, _ := strconv.Atoi(match[1])
+	return pr
+}
+
+// githubReporter annotates the failed tests and writes the job summary. The pull request comments are published by the publishReporter.
+type githubReporter struct {
+	nopReporter
+	conf    GitHubConf
+	pkgsMap map[string]Package
+	lineOut func(str ...string)
+}
+
+func (r githubReporter) OnSummary(result RunResult) error {
+	if !r.conf.Actions {
+		return nil
+	}
+
+	for _, l := range r.conf.annotations(result, r.pkgsMap) {
+		r.lineOut(l)
+	}
+
+	return r.conf.writeSummary(result)
+}
+
+// failureLocation is a 'file_test.go:NN: message' location reported by a failed test
+type failureLocation struct {
+	File    string
+	Line    int
+	Message string
+}
+
+var regexFailureLocation = regexp.MustCompile(`^(\s*)(\S+_test\.go):(\d+): ?(.*)$`)
+
+// failureLocations extracts the file locations (and their messages) from a test output
+func failureLocations(output []string) []failureLocation {
+	locations := []failureLocation{}
+	indent := -1
+
+	for _, l := range output {
+		match := regexFailureLocation.FindStringSubmatch(l)
+		if match != nil {
+			line, _ := strconv.Atoi(match[3])
+			locations = append(locations, failureLocation{File: match[2], Line: line, Message: match[4]})
+			indent = len(match[1])
+			continue
+		}
+
+		// lines indented deeper than the location line are a continuation of its message
+		lineIndent := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent >= 0 && lineIndent > indent && strings.TrimSpace(l) != "" {
+			last := &locations[len(locations)-1]
+			last.Message = strings.TrimSpace(last.Message + "\n" + strings.TrimSpace(l))
+			continue
+		}
+
+		indent = -1
+	}
+
+	return locations
+}
+
+// annotations returns '::error' workflow commands for each failed test
+func (gh GitHubConf) annotations(result RunResult, pkgsMap map[string]Package) []string {
+	lines := []string{}
+
+	for _, test := range result.Tests {
+		if test.Status != "fail" {
+			continue
+		}
+
+		title := test.Package + "." + test.Name
+		locations := failureLocations(test.Output)
+
+		if len(locations) == 0 {
+			// eg. panics or a parent test failing because of its subtests
+			if test.isPanic() {
+				lines = append(lines, githubCommand("error", map[string]string{"title": title}, strings.Join(test.Output, "\n")))
+			}
+			continue
+		}
+
+		for _, loc := range locations {
+			props := map[string]string{
+				"file":  gh.relPath(pkgsMap[test.Package].Dir, loc.File),
+				"line":  strconv.Itoa(loc.Line),
+				"title": title,
+			}
+			lines = append(lines, githubCommand("error", props, zvfb(loc.Message, "test failed")))
+		}
+	}
+
+	return lines
+}
+
+// relPath returns the path of 'file' (in package dir 'pkgDir') relative to the workspace
+func (gh GitHubConf) relPath(pkgDir, file string) string {
+	return relPath(gh.Workspace, pkgDir, file)
+}
+
+// writeSummary appends a markdown table of the package results to the job summary
+func (gh GitHubConf) writeSummary(result RunResult) error {
+	if gh.SummaryPath == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(gh.SummaryPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return fmt.Errorf("failed to open job summary: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(makeGitHubSummary(result))
+	if err != nil {
+		return fmt.Errorf("failed to write job summary: %w", err)
+	}
+
+	return nil
+}
+
+func makeGitHubSummary(result RunResult) string {
+	var sb strings.Builder
+	sb.WriteString("### gotestiful\n\n")
+	sb.WriteString("| | Package | Coverage | Elapsed |\n")
+	sb.WriteString("|---|---|---:|---:|\n")
+
+	for _, pkg := range result.Packages {
+		status := ifelse(pkg.Status == "fail", "❌", "✅")
+		coverage := zvfb(pkg.Coverage, "-")
+		elapsed := sf("%.3fs", pkg.Elapsed)
+
+		switch {
+		case pkg.Status == "fail":
+			elapsed = ifelse(pkg.FailedBuild, "build failed", elapsed)
+		case pkg.NoTests:
+			status, elapsed = "⚠️", "no tests"
+		case pkg.Elapsed == 0:
+			elapsed = "cached"
+		}
+
+		sb.WriteString(sf("| %s | `%s` | %s | %s |\n", status, pkg.Name, coverage, elapsed))
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(sf("**Pkgs:** tested: %d · failed: %d · noTests: %d · excluded: %d  \n",
+		result.TestedPackages, len(result.FailedPackages), len(result.NoTestsPackages), len(result.IgnoredPackages)))
+	sb.WriteString(sf("**Coverage:** %.2f%% %s\n", result.TotalCoverage, ifelse(result.CoverageAccurate, "[accurate]", "[average]")))
+
+	failedTests := []string{}
+	for _, test := range result.Tests {
+		if test.Status == "fail" {
+			failedTests = append(failedTests, sf("- `%s` %s", test.Package, test.Name))
+		}
+	}
+	if len(failedTests) > 0 {
+		sb.WriteString("\n#### Failed tests\n\n")
+		sb.WriteString(strings.Join(failedTests, "\n") + "\n")
+	}
+
+	return sb.String()
+}
+
+// githubCommand formats a workflow command eg. '::error file=a_test.go,line=1::message'
+func githubCommand(command string, props map[string]string, message string) string {
+	cmd := "::" + command
+
+	propsList := []string{}
+	for _, key := range []string{"file", "line", "title"} {
+		if val, ok := props[key]; ok {
+			propsList = append(propsList, key+"="+githubEscapeProperty(val))
+		}
+	}
+	if len(propsList) > 0 {
+		cmd += " " + strings.Join(propsList, ",")
+	}
+
+	return cmd + "::" + githubEscapeData(message)
+}
+
+func githubEscapeData(str string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(str)
+}
+
+func githubEscapeProperty(str string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(str)
+}
+
+type githubComment struct {
+	ID   int64  `json:"id,omitempty"`
+	Body string `json:"body"`
+}
+
+// githubReviewComment is a pull request comment at a file line
+type githubReviewComment struct {
+	ID       int64  `json:"id,omitempty"`
+	Body     string `json:"body"`
+	CommitID string `json:"commit_id,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Side     string `json:"side,omitempty"`
+}
+
+func (gh GitHubConf) Features() PublishFeatures {
+	return gh.PublishFeatures
+}
+
+// PublishComment posts the summary as an issue comment of the pull request, the review comments are the annotations
+func (gh GitHubConf) PublishComment(body string, failed bool) error {
+	comment := githubComment{Body: commentMarker + "\n" + body}
+
+	comments, err := listPages[githubComment](gh.request, pageNumberURL(sf("%s/issues/%d/comments", gh.repoURL(), gh.PullRequest)))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		if strings.Contains(c.Body, commentMarker) {
+			return gh.request(http.MethodPatch, sf("%s/issues/comments/%d", gh.repoURL(), c.ID), comment, nil)
+		}
+	}
+
+	return gh.request(http.MethodPost, sf("%s/issues/%d/comments", gh.repoURL(), gh.PullRequest), comment, nil)
+}
+
+// PublishAnnotations publishes a review comment at the '_test.go' line of each failure.
+// The comments of a previous run are updated if the line still fails, else deleted.
+func (gh GitHubConf) PublishAnnotations(annotations []Annotation) error {
+	failures := map[string]githubReviewComment{}
+	keys := []string{}
+	for _, a := range annotations {
+		c := githubReviewComment{Body: failureMarker + "\n" + a.Body, CommitID: gh.Commit, Path: relPath(gh.Workspace, "", a.File), Line: a.Line, Side: "RIGHT"}
+		key := sf("%s:%d", c.Path, c.Line)
+		failures[key] = c
+		keys = append(keys, key)
+	}
+
+	commentsURL := sf("%s/pulls/%d/comments", gh.repoURL(), gh.PullRequest)
+	comments, err := listPages[githubReviewComment](gh.request, pageNumberURL(commentsURL))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		if !strings.Contains(c.Body, failureMarker) {
+			continue
+		}
+
+		key := sf("%s:%d", c.Path, c.Line)
+		failure, failing := failures[key]
+		if !failing {
+			err = gh.request(http.MethodDelete, sf("%s/pulls/comments/%d", gh.repoURL(), c.ID), nil, nil)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = gh.request(http.MethodPatch, sf("%s/pulls/comments/%d", gh.repoURL(), c.ID), githubComment{Body: failure.Body}, nil)
+		if err != nil {
+			return err
+		}
+		delete(failures, key)
+	}
+
+	if len(failures) > 0 && gh.Commit == "" {
+		return fmt.Errorf("github: the commit is required for the review comments (GITHUB_EVENT_PATH or GITHUB_SHA)")
+	}
+
+	// GitHub rejects the comments at lines outside the diff, they do not stop the others
+	errs := []error{}
+	for _, key := range keys {
+		if !mapHasKey(failures, key) {
+			continue
+		}
+
+		errs = append(errs, gh.request(http.MethodPost, commentsURL, failures[key], nil))
+	}
+
+	return joinErrors(errs)
+}
+
+// PublishStatus sets the commit status of the pull request head
+func (gh GitHubConf) PublishStatus(failed bool, description string) error {
+	if gh.Commit == "" {
+		return fmt.Errorf("github: the commit is required for the status (GITHUB_EVENT_PATH or GITHUB_SHA)")
+	}
+
+	return gh.request(http.MethodPost, gh.repoURL()+"/statuses/"+gh.Commit, map[string]string{
+		"state":       ifelse(failed, "failure", "success"),
+		"context":     "gotestiful",
+		"description": description,
+		"target_url":  gh.BuildURL,
+	}, nil)
+}
+
+func (gh GitHubConf) Ready() error {
+	if gh.Repository == "" || gh.PullRequest == 0 || gh.Token == "" {
+		return fmt.Errorf("github: repository, pull request and token are required (GITHUB_REPOSITORY, GITHUB_REF, GITHUB_TOKEN)")
+	}
+	return nil
+}
+
+// request adds the token and the pinned REST API version headers
+func (gh GitHubConf) request(method, url string, body, out any) error {
+	return apiClient{
+		name: "github",
+		headers: map[string]string{
+			"Authorization":        "Bearer " + gh.Token,
+			"Accept":               "application/vnd.github+json",
+			"X-GitHub-Api-Version": "2022-11-28",
+		},
+		conf: gh.Publish,
+	}.request(method, url, body, out)
+}
+
+func (gh GitHubConf) repoURL() string {
+	return sf("%s/repos/%s", strings.TrimRight(zvfb(gh.APIURL, githubDefaultAPIURL), "/"), gh.Repository)
+}
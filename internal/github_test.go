@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureLocations(t *testing.T) {
+	t.Run("single line messages", func(t *testing.T) {
+		locations := failureLocations([]string{
+			"some print",
+			"    code_test.go:12: first",
+			"    other_test.go:3: second",
+		})
+		assert.Equal(t, []failureLocation{
+			{File: "code_test.go", Line: 12, Message: "first"},
+			{File: "other_test.go", Line: 3, Message: "second"},
+		}, locations)
+	})
+
+	t.Run("multi line message", func(t *testing.T) {
+		locations := failureLocations([]string{
+			"    code_test.go:12: ",
+			"        \tError Trace:\tcode_test.go:12",
+			"        \tError:      \tNot equal",
+			"not part of the message",
+		})
+		assert.Equal(t, []failureLocation{
+			{File: "code_test.go", Line: 12, Message: "Error Trace:\tcode_test.go:12\nError:      \tNot equal"},
+		}, locations)
+	})
+
+	t.Run("no locations", func(t *testing.T) {
+		assert.Empty(t, failureLocations([]string{"panic: boom", "code.go:12: not a test file"}))
+	})
+}
+
+func TestGitHubAnnotations(t *testing.T) {
+	gh := GitHubConf{Actions: true, Workspace: "/repo"}
+	result := RunResult{Tests: []TestResult{
+		{Package: "mod/tst", Name: "TestGood", Status: "pass", Output: []string{"    code_test.go:5: log"}},
+		{Package: "mod/tst", Name: "TestBad", Status: "fail", Output: []string{"    code_test.go:12: 50%, not 100%"}},
+		{Package: "mod/tst", Name: "TestPanic", Status: "fail", Output: []string{"panic: boom", "goroutine 1"}},
+		{Package: "mod/tst", Name: "TestParent", Status: "fail"},
+	}}
+	pkgsMap := map[string]Package{"mod/tst": {Dir: "/repo/tst", ImportPath: "mod/tst"}}
+
+	assert.Equal(t, []string{
+		"::error file=tst/code_test.go,line=12,title=mod/tst.TestBad::50%25, not 100%25",
+		"::error title=mod/tst.TestPanic::panic: boom%0Agoroutine 1",
+	}, gh.annotations(result, pkgsMap))
+}
+
+func TestGitHubCommand(t *testing.T) {
+	assert.Equal(t, "::error::message", githubCommand("error", nil, "message"))
+	assert.Equal(t, "::error file=a%2Cb%3Ac,line=1::one%0Atwo", githubCommand("error", map[string]string{"line": "1", "file": "a,b:c"}, "one\ntwo"))
+}
+
+func TestMakeGitHubSummary(t *testing.T) {
+	result := RunResult{
+		Packages: []PackageResult{
+			{Name: "one", Status: "pass", Elapsed: 0.1, Coverage: "80.0%"},
+			{Name: "two", Status: "fail", Elapsed: 0.2, Coverage: "40.0%"},
+			{Name: "three", Status: "pass", Elapsed: 0},
+			{Name: "four", Status: "skip", NoTests: true},
+		},
+		Tests: []TestResult{
+			{Package: "two", Name: "TestBad", Status: "fail"},
+		},
+		TestedPackages:  4,
+		FailedPackages:  []string{"two"},
+		NoTestsPackages: []string{"four"},
+		IgnoredPackages: []string{"five"},
+		TotalCoverage:   60,
+	}
+
+	assert.Equal(t, "### gotestiful\n\n"+
+		"| | Package | Coverage | Elapsed |\n"+
+		"|---|---|---:|---:|\n"+
+		"| ✅ | `one` | 80.0% | 0.100s |\n"+
+		"| ❌ | `two` | 40.0% | 0.200s |\n"+
+		"| ✅ | `three` | - | cached |\n"+
+		"| ⚠️ | `four` | - | no tests |\n"+
+		"\n"+
+		"**Pkgs:** tested: 4 · failed: 1 · noTests: 1 · excluded: 1  \n"+
+		"**Coverage:** 60.00% [average]\n"+
+		"\n#### Failed tests\n\n"+
+		"- `two` TestBad\n", makeGitHubSummary(result))
+}
+
+func TestGitHubPullRequestFromRef(t *testing.T) {
+	assert.Equal(t, 123, githubPullRequestFromRef("refs/pull/123/merge"))
+	assert.Equal(t, 0, githubPullRequestFromRef("refs/heads/main"))
+	assert.Equal(t, 0, githubPullRequestFromRef(""))
+}
+
+func TestGitHubConfFromEnv(t *testing.T) {
+	event := filepath.Join(t.TempDir(), "event.json")
+	assert.NoError(t, os.WriteFile(event, []byte(`{"pull_request": {"head": {"sha": "head"}}}`), 0o666))
+
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_WORKSPACE", "/ws")
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	t.Setenv("GITHUB_API_URL", "")
+	t.Setenv("GITHUB_SERVER_URL", "https://github.com")
+	t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+	t.Setenv("GITHUB_REF", "refs/pull/7/merge")
+	t.Setenv("GITHUB_SHA", "merge")
+	t.Setenv("GITHUB_EVENT_PATH", event)
+	t.Setenv("GITHUB_RUN_ID", "99")
+	t.Setenv("GITHUB_TOKEN", "tkn")
+
+	assert.Equal(t, GitHubConf{
+		PublishFeatures: PublishFeatures{Status: true},
+		APIURL:          githubDefaultAPIURL,
+		Actions:         true,
+		Workspace:       "/ws",
+		Repository:      "owner/repo",
+		PullRequest:     7,
+		Commit:          "head",
+		BuildURL:        "https://github.com/owner/repo/actions/runs/99",
+		Token:           "tkn",
+	}, GitHubConfFromEnv(GitHubConf{PublishFeatures: PublishFeatures{Status: true}}))
+
+	t.Setenv("GITHUB_EVENT_PATH", "")
+	assert.Equal(t, "merge", GitHubConfFromEnv(GitHubConf{}).Commit, "not a pull request event")
+	assert.Equal(t, "https://github.example.com/api/v3", GitHubConfFromEnv(GitHubConf{APIURL: "https://github.example.com/api/v3"}).APIURL)
+}
+
+func TestGitHubPublish(t *testing.T) {
+	type request struct {
+		Method, Path, Auth, Body string
+	}
+
+	stub := func(responses map[string]string) (*httptest.Server, *[]request) {
+		requests := []request{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests = append(requests, request{r.Method, r.URL.Path, r.Header.Get("Authorization"), string(body)})
+			_, _ = w.Write([]byte(zvfb(responses[r.Method+" "+r.URL.Path], "{}")))
+		}))
+		return server, &requests
+	}
+
+	conf := func(serverURL string) GitHubConf {
+		return GitHubConf{APIURL: serverURL + "/", Repository: "owner/repo", PullRequest: 7, Commit: "abc", Token: "tkn", Workspace: "/ws"}
+	}
+
+	t.Run("missing settings", func(t *testing.T) {
+		assert.EqualError(t, GitHubConf{Repository: "owner/repo"}.Ready(), "github: repository, pull request and token are required (GITHUB_REPOSITORY, GITHUB_REF, GITHUB_TOKEN)")
+	})
+
+	t.Run("creates comment", func(t *testing.T) {
+		server, requests := stub(map[string]string{"GET /repos/owner/repo/issues/7/comments": `[{"id": 1, "body": "someone else"}]`})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishComment("Total coverage is 75.00%", false))
+		body, _ := json.Marshal(githubComment{Body: commentMarker + "\nTotal coverage is 75.00%"})
+		assert.Equal(t, []request{
+			{http.MethodGet, "/repos/owner/repo/issues/7/comments", "Bearer tkn", ""},
+			{http.MethodPost, "/repos/owner/repo/issues/7/comments", "Bearer tkn", string(body)},
+		}, *requests)
+	})
+
+	t.Run("updates own comment", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"GET /repos/owner/repo/issues/7/comments": `[{"id": 1, "body": "someone else"}, {"id": 42, "body": "` + commentMarker + `\nold"}]`,
+		})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishComment("Total coverage is 75.00%", false))
+		body, _ := json.Marshal(githubComment{Body: commentMarker + "\nTotal coverage is 75.00%"})
+		assert.Equal(t, []request{
+			{http.MethodGet, "/repos/owner/repo/issues/7/comments", "Bearer tkn", ""},
+			{http.MethodPatch, "/repos/owner/repo/issues/comments/42", "Bearer tkn", string(body)},
+		}, *requests)
+	})
+
+	t.Run("review comments", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"GET /repos/owner/repo/pulls/7/comments": `[
+				{"id": 1, "body": "nit", "path": "pkg/a_test.go", "line": 12},
+				{"id": 2, "body": "` + failureMarker + `\nold", "path": "pkg/a_test.go", "line": 12},
+				{"id": 3, "body": "` + failureMarker + `\nfixed", "path": "pkg/b_test.go", "line": 5}
+			]`,
+		})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishAnnotations([]Annotation{
+			{File: "/ws/pkg/a_test.go", Line: 12, Body: "want 1"},
+			{File: "/ws/pkg/c_test.go", Line: 30, Body: "boom"},
+		}))
+		updated, _ := json.Marshal(githubComment{Body: failureMarker + "\nwant 1"})
+		created, _ := json.Marshal(githubReviewComment{Body: failureMarker + "\nboom", CommitID: "abc", Path: "pkg/c_test.go", Line: 30, Side: "RIGHT"})
+		assert.Equal(t, []request{
+			{http.MethodGet, "/repos/owner/repo/pulls/7/comments", "Bearer tkn", ""},
+			{http.MethodPatch, "/repos/owner/repo/pulls/comments/2", "Bearer tkn", string(updated)},
+			{http.MethodDelete, "/repos/owner/repo/pulls/comments/3", "Bearer tkn", ""},
+			{http.MethodPost, "/repos/owner/repo/pulls/7/comments", "Bearer tkn", string(created)},
+		}, *requests)
+	})
+
+	t.Run("review comments outside the diff", func(t *testing.T) {
+		posts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				posts++
+				if posts == 1 {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+				}
+			}
+			_, _ = w.Write([]byte(ifelse(r.Method == http.MethodGet, "[]", "{}")))
+		}))
+		defer server.Close()
+
+		err := conf(server.URL).PublishAnnotations([]Annotation{
+			{File: "/ws/pkg/a_test.go", Line: 12, Body: "want 1"},
+			{File: "/ws/pkg/c_test.go", Line: 30, Body: "boom"},
+		})
+		assert.ErrorContains(t, err, "422 Unprocessable Entity")
+		assert.Equal(t, 2, posts, "the next comment is still published")
+	})
+
+	t.Run("status", func(t *testing.T) {
+		server, requests := stub(nil)
+		defer server.Close()
+
+		gh := conf(server.URL)
+		gh.BuildURL = "https://github.com/owner/repo/actions/runs/99"
+		assert.NoError(t, gh.PublishStatus(false, "Tests passed"))
+		assert.Equal(t, []request{
+			{http.MethodPost, "/repos/owner/repo/statuses/abc", "Bearer tkn", `{"context":"gotestiful","description":"Tests passed","state":"success","target_url":"https://github.com/owner/repo/actions/runs/99"}`},
+		}, *requests)
+
+		gh.Commit = ""
+		assert.ErrorContains(t, gh.PublishStatus(false, ""), "github: the commit is required")
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		assert.ErrorContains(t, conf(server.URL).PublishComment("", false), "403 Forbidden")
+	})
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GitLabConf holds the GitLab CI and merge request settings, set in the config 'gitlab' section.
+type GitLabConf struct {
+	PublishFeatures
+	APIURL string `json:"apiUrl"` // v4 REST API url eg. https://gitlab.example.com/api/v4, defaults to CI_API_V4_URL
+
+	CI           bool   `json:"-"` // running in GitLab CI (coverage line and report artifacts)
+	ProjectDir   string `json:"-"` // repository root, discussion paths are relative to it
+	ProjectID    string `json:"-"`
+	MergeRequest int    `json:"-"`
+	Commit       string `json:"-"` // the commit status is set on it
+	BuildURL     string `json:"-"` // link of the commit status
+	Token        string `json:"-"` // GITLAB_TOKEN
+
+	Publish PublishConf `json:"-"`
+}
+
+// GitLabConfFromEnv completes the 'conf' settings with GitLab CI and the merge request details from the predefined CI variables
+func GitLabConfFromEnv(conf GitLabConf) GitLabConf {
+	conf.CI = os.Getenv("GITLAB_CI") == "true"
+	conf.APIURL = zvfb(conf.APIURL, os.Getenv("CI_API_V4_URL"))
+	conf.ProjectDir = os.Getenv("CI_PROJECT_DIR")
+	conf.ProjectID = os.Getenv("CI_PROJECT_ID")
+	conf.MergeRequest, _ = strconv.Atoi(os.Getenv("CI_MERGE_REQUEST_IID"))
+	conf.Commit = os.Getenv("CI_COMMIT_SHA")
+	conf.BuildURL = os.Getenv("CI_JOB_URL")
+	conf.Token = os.Getenv("GITLAB_TOKEN")
+	return conf
+}
+
+// coverageLine returns the total coverage in the format matched by the coverage regex '/^coverage: \d+\.\d+%/'
+func (gl GitLabConf) coverageLine(coverage float64) string {
+	return sf("coverage: %.2f%%", coverage)
+}
+
+// gitlabReporter prints the coverage line. The merge request notes are published by the publishReporter.
+type gitlabReporter struct {
+	nopReporter
+	conf    GitLabConf
+	lineOut func(str ...string)
+}
+
+func (r gitlabReporter) OnSummary(result RunResult) error {
+	if r.conf.CI {
+		r.lineOut(r.conf.coverageLine(result.TotalCoverage))
+	}
+	return nil
+}
+
+type gitlabNote struct {
+	ID       int64               `json:"id,omitempty"`
+	Body     string              `json:"body"`
+	Resolved bool                `json:"resolved,omitempty"`
+	Position *gitlabDiffPosition `json:"position,omitempty"`
+}
+
+// gitlabDiscussion is a merge request thread, the failure ones are positioned at a file line of the diff
+type gitlabDiscussion struct {
+	ID    string       `json:"id"`
+	Notes []gitlabNote `json:"notes"`
+}
+
+type gitlabDiffPosition struct {
+	PositionType string `json:"position_type"`
+	BaseSHA      string `json:"base_sha"`
+	StartSHA     string `json:"start_sha"`
+	HeadSHA      string `json:"head_sha"`
+	NewPath      string `json:"new_path"`
+	NewLine      int    `json:"new_line"`
+}
+
+func (gl GitLabConf) Features() PublishFeatures {
+	return gl.PublishFeatures
+}
+
+// PublishComment posts the summary as a merge request note
+func (gl GitLabConf) PublishComment(body string, failed bool) error {
+	note := gitlabNote{Body: commentMarker + "\n" + body}
+
+	notes, err := listPages[gitlabNote](gl.request, pageNumberURL(gl.mergeRequestURL()+"/notes"))
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notes {
+		if strings.Contains(n.Body, commentMarker) {
+			return gl.request(http.MethodPut, sf("%s/notes/%d", gl.mergeRequestURL(), n.ID), note, nil)
+		}
+	}
+
+	return gl.request(http.MethodPost, gl.mergeRequestURL()+"/notes", note, nil)
+}
+
+// PublishAnnotations publishes a discussion at the '_test.go' line of each failure.
+// The discussions of a previous run are updated (and reopened) if the line still fails, else resolved.
+func (gl GitLabConf) PublishAnnotations(annotations []Annotation) error {
+	failures := map[string]gitlabNote{}
+	keys := []string{}
+	for _, a := range annotations {
+		n := gitlabNote{Body: failureMarker + "\n" + a.Body, Position: &gitlabDiffPosition{PositionType: "text", NewPath: relPath(gl.ProjectDir, "", a.File), NewLine: a.Line}}
+		key := sf("%s:%d", n.Position.NewPath, n.Position.NewLine)
+		failures[key] = n
+		keys = append(keys, key)
+	}
+
+	discussionsURL := gl.mergeRequestURL() + "/discussions"
+	discussions, err := listPages[gitlabDiscussion](gl.request, pageNumberURL(discussionsURL))
+	if err != nil {
+		return err
+	}
+
+	for _, d := range discussions {
+		if len(d.Notes) == 0 || d.Notes[0].Position == nil || !strings.Contains(d.Notes[0].Body, failureMarker) {
+			continue
+		}
+
+		first := d.Notes[0]
+		key := sf("%s:%d", first.Position.NewPath, first.Position.NewLine)
+		failure, failing := failures[key]
+		if !failing {
+			if !first.Resolved {
+				err = gl.request(http.MethodPut, sf("%s/%s?resolved=true", discussionsURL, d.ID), nil, nil)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err = gl.request(http.MethodPut, sf("%s/%s/notes/%d", discussionsURL, d.ID, first.ID), gitlabNote{Body: failure.Body}, nil)
+		if err == nil && first.Resolved {
+			err = gl.request(http.MethodPut, sf("%s/%s?resolved=false", discussionsURL, d.ID), nil, nil)
+		}
+		if err != nil {
+			return err
+		}
+		delete(failures, key)
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	// new discussions are positioned on the diff of the merge request versions
+	var mr struct {
+		DiffRefs struct {
+			BaseSHA  string `json:"base_sha"`
+			StartSHA string `json:"start_sha"`
+			HeadSHA  string `json:"head_sha"`
+		} `json:"diff_refs"`
+	}
+	err = gl.request(http.MethodGet, gl.mergeRequestURL(), nil, &mr)
+	if err != nil {
+		return err
+	}
+
+	// GitLab rejects the positions outside the diff, they do not stop the others
+	errs := []error{}
+	for _, key := range keys {
+		failure, ok := failures[key]
+		if !ok {
+			continue
+		}
+
+		failure.Position.BaseSHA = mr.DiffRefs.BaseSHA
+		failure.Position.StartSHA = mr.DiffRefs.StartSHA
+		failure.Position.HeadSHA = mr.DiffRefs.HeadSHA
+		errs = append(errs, gl.request(http.MethodPost, discussionsURL, failure, nil))
+	}
+
+	return joinErrors(errs)
+}
+
+// PublishStatus sets the commit status of the pipeline commit
+func (gl GitLabConf) PublishStatus(failed bool, description string) error {
+	if gl.Commit == "" {
+		return fmt.Errorf("gitlab: the commit is required for the status (CI_COMMIT_SHA)")
+	}
+
+	return gl.request(http.MethodPost, sf("%s/projects/%s/statuses/%s", strings.TrimRight(gl.APIURL, "/"), url.PathEscape(gl.ProjectID), gl.Commit), map[string]string{
+		"state":       ifelse(failed, "failed", "success"),
+		"name":        "gotestiful",
+		"description": description,
+		"target_url":  gl.BuildURL,
+	}, nil)
+}
+
+func (gl GitLabConf) Ready() error {
+	if gl.APIURL == "" || gl.ProjectID == "" || gl.MergeRequest == 0 || gl.Token == "" {
+		return fmt.Errorf("gitlab: api url, project, merge request and token are required (CI_API_V4_URL, CI_PROJECT_ID, CI_MERGE_REQUEST_IID, GITLAB_TOKEN)")
+	}
+	return nil
+}
+
+func (gl GitLabConf) mergeRequestURL() string {
+	return sf("%s/projects/%s/merge_requests/%d", strings.TrimRight(gl.APIURL, "/"), url.PathEscape(gl.ProjectID), gl.MergeRequest)
+}
+
+func (gl GitLabConf) request(method, reqURL string, body, out any) error {
+	return apiClient{
+		name:    "gitlab",
+		headers: map[string]string{"PRIVATE-TOKEN": gl.Token},
+		conf:    gl.Publish,
+	}.request(method, reqURL, body, out)
+}
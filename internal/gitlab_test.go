@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitLabCoverageLine(t *testing.T) {
+	assert.Equal(t, "coverage: 71.30%", GitLabConf{}.coverageLine(71.3))
+	assert.Equal(t, "coverage: 0.00%", GitLabConf{}.coverageLine(0))
+}
+
+func TestGitLabConfFromEnv(t *testing.T) {
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_API_V4_URL", "https://gitlab.com/api/v4")
+	t.Setenv("CI_PROJECT_DIR", "/builds/group/project")
+	t.Setenv("CI_PROJECT_ID", "12")
+	t.Setenv("CI_MERGE_REQUEST_IID", "3")
+	t.Setenv("CI_COMMIT_SHA", "abc")
+	t.Setenv("CI_JOB_URL", "https://gitlab.com/group/project/-/jobs/1")
+	t.Setenv("GITLAB_TOKEN", "tkn")
+
+	assert.Equal(t, GitLabConf{
+		PublishFeatures: PublishFeatures{Comment: true},
+		APIURL:          "https://gitlab.com/api/v4",
+		CI:              true,
+		ProjectDir:      "/builds/group/project",
+		ProjectID:       "12",
+		MergeRequest:    3,
+		Commit:          "abc",
+		BuildURL:        "https://gitlab.com/group/project/-/jobs/1",
+		Token:           "tkn",
+	}, GitLabConfFromEnv(GitLabConf{PublishFeatures: PublishFeatures{Comment: true}}))
+
+	assert.Equal(t, "https://gitlab.example.com/api/v4", GitLabConfFromEnv(GitLabConf{APIURL: "https://gitlab.example.com/api/v4"}).APIURL)
+}
+
+func TestGitLabPublish(t *testing.T) {
+	type request struct {
+		Method, Path, Token, Body string
+	}
+
+	stub := func(responses map[string]string) (*httptest.Server, *[]request) {
+		requests := []request{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			path := r.URL.EscapedPath() + ifelse(r.URL.Query().Has("resolved"), "?resolved="+r.URL.Query().Get("resolved"), "")
+			requests = append(requests, request{r.Method, path, r.Header.Get("PRIVATE-TOKEN"), string(body)})
+			_, _ = w.Write([]byte(zvfb(responses[r.Method+" "+r.URL.EscapedPath()], "{}")))
+		}))
+		return server, &requests
+	}
+
+	conf := func(serverURL string) GitLabConf {
+		return GitLabConf{APIURL: serverURL + "/api/v4", ProjectID: "group/project", MergeRequest: 3, Commit: "abc", Token: "tkn", ProjectDir: "/builds"}
+	}
+	const mrPath = "/api/v4/projects/group%2Fproject/merge_requests/3"
+
+	t.Run("missing settings", func(t *testing.T) {
+		assert.ErrorContains(t, GitLabConf{ProjectID: "1"}.Ready(), "gitlab: api url, project, merge request and token are required")
+	})
+
+	t.Run("creates note", func(t *testing.T) {
+		server, requests := stub(map[string]string{"GET " + mrPath + "/notes": `[{"id": 1, "body": "someone else"}]`})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishComment("Total coverage is 75.00%", false))
+		body, _ := json.Marshal(gitlabNote{Body: commentMarker + "\nTotal coverage is 75.00%"})
+		assert.Equal(t, []request{
+			{http.MethodGet, mrPath + "/notes", "tkn", ""},
+			{http.MethodPost, mrPath + "/notes", "tkn", string(body)},
+		}, *requests)
+	})
+
+	t.Run("updates own note", func(t *testing.T) {
+		server, requests := stub(map[string]string{"GET " + mrPath + "/notes": `[{"id": 1, "body": "someone else"}, {"id": 9, "body": "` + commentMarker + `\nold"}]`})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishComment("Total coverage is 75.00%", false))
+		body, _ := json.Marshal(gitlabNote{Body: commentMarker + "\nTotal coverage is 75.00%"})
+		assert.Equal(t, []request{
+			{http.MethodGet, mrPath + "/notes", "tkn", ""},
+			{http.MethodPut, mrPath + "/notes/9", "tkn", string(body)},
+		}, *requests)
+	})
+
+	t.Run("discussions", func(t *testing.T) {
+		server, requests := stub(map[string]string{
+			"GET " + mrPath + "/discussions": `[
+				{"id": "d1", "notes": [{"id": 1, "body": "nit", "position": {"new_path": "pkg/a_test.go", "new_line": 12}}]},
+				{"id": "d2", "notes": [{"id": 2, "body": "` + failureMarker + `\nold", "resolved": true, "position": {"new_path": "pkg/a_test.go", "new_line": 12}}]},
+				{"id": "d3", "notes": [{"id": 3, "body": "` + failureMarker + `\nfixed", "position": {"new_path": "pkg/b_test.go", "new_line": 5}}]}
+			]`,
+			"GET " + mrPath: `{"diff_refs": {"base_sha": "base", "start_sha": "start", "head_sha": "head"}}`,
+		})
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishAnnotations([]Annotation{
+			{File: "/builds/pkg/a_test.go", Line: 12, Body: "want 1"},
+			{File: "/builds/pkg/c_test.go", Line: 30, Body: "boom"},
+		}))
+		updated, _ := json.Marshal(gitlabNote{Body: failureMarker + "\nwant 1"})
+		created, _ := json.Marshal(gitlabNote{Body: failureMarker + "\nboom", Position: &gitlabDiffPosition{
+			PositionType: "text", BaseSHA: "base", StartSHA: "start", HeadSHA: "head", NewPath: "pkg/c_test.go", NewLine: 30,
+		}})
+		assert.Equal(t, []request{
+			{http.MethodGet, mrPath + "/discussions", "tkn", ""},
+			{http.MethodPut, mrPath + "/discussions/d2/notes/2", "tkn", string(updated)},
+			{http.MethodPut, mrPath + "/discussions/d2?resolved=false", "tkn", ""},
+			{http.MethodPut, mrPath + "/discussions/d3?resolved=true", "tkn", ""},
+			{http.MethodGet, mrPath, "tkn", ""},
+			{http.MethodPost, mrPath + "/discussions", "tkn", string(created)},
+		}, *requests)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		server, requests := stub(nil)
+		defer server.Close()
+
+		assert.NoError(t, conf(server.URL).PublishStatus(true, "1 tests failed"))
+		assert.Equal(t, []request{
+			{http.MethodPost, "/api/v4/projects/group%2Fproject/statuses/abc", "tkn", `{"description":"1 tests failed","name":"gotestiful","state":"failed","target_url":""}`},
+		}, *requests)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		assert.ErrorContains(t, conf(server.URL).PublishComment("", false), "401 Unauthorized")
+	})
+}
@@ -28,7 +28,12 @@ func PrintHelp() {
 	fmt.Println(chev, shColor("white", "gotestiful -cache=false"), shColor("gray", "runs 'go test -count=1 ./...'"))
 	fmt.Println(chev, shColor("white", "gotestiful -v"), shColor("gray", "runs 'go test -v ./...'"))
 	fmt.Println(chev, shColor("white", "gotestiful some/package"), shColor("gray", "runs 'go test some/package'"))
-	fmt.Println(chev, shColor("white", "gotestiful init"), shColor("gray", "creates default config at ./.gotestiful"))
+	fmt.Println(chev, shColor("white", "gotestiful init"), shColor("gray", "creates a config at ./.gotestiful, proposing excludes for the module packages"))
+	fmt.Println(chev, shColor("white", "gotestiful init -format yaml"), shColor("gray", "creates default config at ./.gotestiful.yaml (or toml)"))
+	fmt.Println(chev, shColor("white", "gotestiful init -yes"), shColor("gray", "accepts the suggested excludes (generated code, mocks, ...) without asking"))
+	fmt.Println(chev, shColor("white", "gotestiful schema"), shColor("gray", "prints the config JSON Schema"))
+	fmt.Println(chev, shColor("white", "gotestiful -profile ci config"), shColor("gray", "shows the resolved settings and the source of each one"))
+	fmt.Println(chev, shColor("white", "gotestiful config migrate"), shColor("gray", "upgrades the config files to the current format version"))
 
 	fmt.Println()
 	fmt.Println(shColor("gray", strings.Repeat("-", 60)))
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// listedPackage is a 'go list -json' package with the files the init wizard inspects
+type listedPackage struct {
+	Package
+	GoFiles      []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+}
+
+// initSuggestion is a config change proposed by the init wizard, 'reason' is shown in the prompt
+type initSuggestion struct {
+	exclude string // exclude entry, or
+	setting string // config key set to true eg. 'output.listEmpty'
+	reason  string
+}
+
+// regexGenerated matches the generated code header, see https://pkg.go.dev/cmd/go#hdr-Generate_Go_files_by_processing_source
+var regexGenerated = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+var regexPackageClause = regexp.MustCompile(`(?m)^package `)
+
+// regexMockPkg matches mock packages by their last path element eg. 'mocks', 'mock' or 'mock_store'
+var regexMockPkg = regexp.MustCompile(`(^|/)(mocks?|mock_[^/]*|[^/]*mocks)$`)
+
+// listModulePackages lists the packages of the module with 'go list'
+func listModulePackages() ([]listedPackage, error) {
+	pkgs := []listedPackage{}
+
+	pkgChan := make(chan listedPackage)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		for p := range pkgChan {
+			pkgs = append(pkgs, p)
+		}
+		wg.Done()
+	}()
+
+	err := shJSONPipe("go", shArgs{"list", "-json", "./..."}, "", pkgChan, io.Discard)
+	wg.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+
+	return pkgs, nil
+}
+
+// isGeneratedFile checks the 'Code generated ... DO NOT EDIT.' header before the package clause
+func isGeneratedFile(path string) bool {
+	if strings.HasSuffix(path, ".pb.go") {
+		return true
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	header := data
+	if loc := regexPackageClause.FindIndex(data); loc != nil {
+		header = data[:loc[0]]
+	}
+	return regexGenerated.Match(header)
+}
+
+// suggestConfig inspects the module packages and proposes excluding generated code, mocks and main packages without tests,
+// and listing the packages without tests. Exclude entries are directory patterns relative to the module 'root'.
+func suggestConfig(pkgs []listedPackage, root string) []initSuggestion {
+	suggestions := []initSuggestion{}
+	noTests := 0
+
+	for _, p := range pkgs {
+		rel := relPath(root, "", p.Dir)
+		dirPattern := ifelse(rel == ".", ".", "./"+rel)
+		hasTests := len(p.TestGoFiles)+len(p.XTestGoFiles) > 0
+
+		generated := []string{}
+		for _, f := range p.GoFiles {
+			if isGeneratedFile(filepath.Join(p.Dir, f)) {
+				generated = append(generated, f)
+			}
+		}
+
+		switch {
+		case len(p.GoFiles) > 0 && len(generated) == len(p.GoFiles):
+			suggestions = append(suggestions, initSuggestion{exclude: dirPattern, reason: "generated code: " + strings.Join(generated, ", ")})
+
+		case regexMockPkg.MatchString(p.ImportPath):
+			suggestions = append(suggestions, initSuggestion{exclude: dirPattern, reason: "mocks"})
+
+		case p.Name == "main" && !hasTests:
+			suggestions = append(suggestions, initSuggestion{exclude: dirPattern, reason: "main package without tests"})
+
+		case !hasTests:
+			noTests++
+		}
+	}
+
+	if noTests > 0 {
+		suggestions = append(suggestions, initSuggestion{setting: "output.listEmpty", reason: sf("%d %s without tests", noTests, ifelse(noTests == 1, "package", "packages"))})
+	}
+
+	return suggestions
+}
+
+// applySuggestion sets the suggested exclude entry or setting in 'c'
+func (c *config) applySuggestion(s initSuggestion) {
+	switch {
+	case s.exclude != "":
+		c.Exclude = append(c.Exclude, s.exclude)
+	case s.setting == "output.listEmpty":
+		c.Output.ListEmpty = true
+	}
+}
+
+// prompter asks yes/no questions, the default answer is taken on an empty line or end of input
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p prompter) confirm(question string, def bool) bool {
+	fmt.Fprintf(p.out, "%s %s ", question, shColor("gray", ifelse(def, "[Y/n]", "[y/N]")))
+
+	for {
+		line, err := p.in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case answer == "" && err != nil:
+			fmt.Fprintln(p.out)
+			return def
+		case answer == "":
+			return def
+		case answer == "y" || answer == "yes":
+			return true
+		case answer == "n" || answer == "no":
+			return false
+		}
+		fmt.Fprintf(p.out, "please answer y or n %s ", shColor("gray", ifelse(def, "[Y/n]", "[y/N]")))
+	}
+}
+
+// initWizard proposes the 'suggestions' one by one (or accepts them all if 'yes') and returns the resulting config
+func initWizard(suggestions []initSuggestion, yes bool, p prompter) config {
+	c := conf
+	c.Exclude = []string{}
+
+	for _, s := range suggestions {
+		question := ifelse(s.exclude != "", sf("Exclude %s (%s)?", s.exclude, s.reason), sf("Set %s (%s)?", s.setting, s.reason))
+		if yes {
+			fmt.Fprintln(p.out, question, shColor("gray", "yes"))
+			c.applySuggestion(s)
+			continue
+		}
+		if p.confirm(question, true) {
+			c.applySuggestion(s)
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsGeneratedFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"gen.go":     "// Code generated by mockgen. DO NOT EDIT.\n\npackage store\n",
+		"license.go": "// Copyright 2024\n\n// Code generated by stringer. DO NOT EDIT.\n\npackage store\n",
+		"hand.go":    "package store\n\n// Code generated by hand. DO NOT EDIT.\n",
+		"api.pb.go":  "package api\n",
+		"plain.go":   "package store\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o666))
+	}
+
+	assert.True(t, isGeneratedFile(filepath.Join(dir, "gen.go")))
+	assert.True(t, isGeneratedFile(filepath.Join(dir, "license.go")))
+	assert.False(t, isGeneratedFile(filepath.Join(dir, "hand.go")), "after the package clause")
+	assert.True(t, isGeneratedFile(filepath.Join(dir, "api.pb.go")))
+	assert.False(t, isGeneratedFile(filepath.Join(dir, "plain.go")))
+	assert.False(t, isGeneratedFile(filepath.Join(dir, "missing.go")))
+}
+
+func TestSuggestConfig(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, dir := range []string{"pb", "store", "store/mock_store", "cmd/app", "util"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o777))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "pb", "api.go"), []byte("// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage pb\n"), 0o666))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "store", "store.go"), []byte("package store\n"), 0o666))
+
+	pkgs := []listedPackage{
+		{Package: Package{ImportPath: "mod", Dir: root, Name: "mod"}, GoFiles: []string{"mod.go"}, TestGoFiles: []string{"mod_test.go"}},
+		{Package: Package{ImportPath: "mod/pb", Dir: filepath.Join(root, "pb"), Name: "pb"}, GoFiles: []string{"api.go"}},
+		{Package: Package{ImportPath: "mod/store", Dir: filepath.Join(root, "store"), Name: "store"}, GoFiles: []string{"store.go"}, XTestGoFiles: []string{"store_test.go"}},
+		{Package: Package{ImportPath: "mod/store/mock_store", Dir: filepath.Join(root, "store", "mock_store"), Name: "mock_store"}, GoFiles: []string{"store.go"}},
+		{Package: Package{ImportPath: "mod/cmd/app", Dir: filepath.Join(root, "cmd", "app"), Name: "main"}, GoFiles: []string{"main.go"}},
+		{Package: Package{ImportPath: "mod/util", Dir: filepath.Join(root, "util"), Name: "util"}, GoFiles: []string{"util.go"}},
+	}
+
+	assert.Equal(t, []initSuggestion{
+		{exclude: "./pb", reason: "generated code: api.go"},
+		{exclude: "./store/mock_store", reason: "mocks"},
+		{exclude: "./cmd/app", reason: "main package without tests"},
+		{setting: "output.listEmpty", reason: "1 package without tests"},
+	}, suggestConfig(pkgs, root))
+
+	assert.Equal(t, []initSuggestion{}, suggestConfig(pkgs[:1], root))
+}
+
+func TestPrompterConfirm(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	p := prompter{in: bufio.NewReader(strings.NewReader("y\nNO\n\nmaybe\nyes\n")), out: &out}
+
+	assert.True(t, p.confirm("first?", false))
+	assert.False(t, p.confirm("second?", true))
+	assert.True(t, p.confirm("third?", true), "empty answer takes the default")
+	assert.True(t, p.confirm("fourth?", false), "asks again until y or n")
+	assert.False(t, p.confirm("fifth?", false), "end of input takes the default")
+	assert.Contains(t, out.String(), "please answer y or n")
+}
+
+func TestInitWizard(t *testing.T) {
+	t.Parallel()
+
+	suggestions := []initSuggestion{
+		{exclude: "./pb", reason: "generated code: api.go"},
+		{exclude: "./mocks", reason: "mocks"},
+		{setting: "output.listEmpty", reason: "2 packages without tests"},
+	}
+
+	var out bytes.Buffer
+	c := initWizard(suggestions, false, prompter{in: bufio.NewReader(strings.NewReader("\nn\ny\n")), out: &out})
+	assert.Equal(t, []string{"./pb"}, c.Exclude)
+	assert.True(t, c.Output.ListEmpty)
+	assert.Contains(t, out.String(), "Exclude ./mocks (mocks)?")
+
+	c = initWizard(suggestions, true, prompter{in: bufio.NewReader(strings.NewReader("")), out: &out})
+	assert.Equal(t, []string{"./pb", "./mocks"}, c.Exclude)
+	assert.True(t, c.Output.ListEmpty)
+	assert.Empty(t, conf.Exclude, "the defaults are not changed")
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	TestCases  []junitTestCase  `xml:"testcase"`
+	SystemOut  *junitOutput     `xml:"system-out,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Contents string `xml:",cdata"`
+}
+
+// junitReporter writes the run result as a JUnit XML report
+type junitReporter struct {
+	nopReporter
+	filePath string
+}
+
+func (r junitReporter) OnSummary(result RunResult) error {
+	return writeJUnit(r.filePath, result)
+}
+
+// buildJUnit converts the run result to JUnit test suites (one per package)
+func buildJUnit(result RunResult) junitTestSuites {
+	suites := junitTestSuites{}
+	var totalTime float64
+
+	for _, pkg := range result.Packages {
+		suite := junitTestSuite{
+			Name:      pkg.Name,
+			Time:      junitTime(pkg.Elapsed),
+			TestCases: []junitTestCase{},
+		}
+
+		if !pkg.Start.IsZero() {
+			suite.Timestamp = pkg.Start.Format(time.RFC3339)
+		}
+
+		if pkg.Coverage != "" {
+			suite.Properties = &junitProperties{[]junitProperty{{Name: "coverage", Value: pkg.Coverage}}}
+		}
+
+		testsFailed := false
+		for _, test := range result.packageTests(pkg.Name) {
+			testCase := junitTestCase{
+				ClassName: pkg.Name,
+				Name:      test.Name,
+				Time:      junitTime(test.Elapsed),
+			}
+
+			output := strings.Join(test.Output, "\n")
+			switch {
+			case test.Status == "fail" && test.isPanic():
+				testCase.Error = &junitMessage{Message: "Panicked", Contents: output}
+				suite.Errors++
+				testsFailed = true
+
+			case test.Status == "fail":
+				testCase.Failure = &junitMessage{Message: "Failed", Contents: output}
+				suite.Failures++
+				testsFailed = true
+
+			case test.Status == "skip":
+				testCase.Skipped = &junitMessage{Message: zvfb(strings.TrimSpace(output), "Skipped")}
+				suite.Skipped++
+
+			default:
+				testCase.SystemOut = junitOutputOf(test.Output)
+			}
+
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+
+		// A failed package without failed tests means it did not build or it failed outside of a test
+		if pkg.Status == "fail" && !testsFailed {
+			name := ifelse(pkg.FailedBuild, "[build failed]", "[package failed]")
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				ClassName: pkg.Name,
+				Name:      name,
+				Time:      junitTime(0),
+				Error:     &junitMessage{Message: name, Contents: strings.Join(pkg.Output, "\n")},
+			})
+			suite.Errors++
+
+		} else {
+			suite.SystemOut = junitOutputOf(pkg.Output)
+		}
+
+		suite.Tests = len(suite.TestCases)
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		totalTime += pkg.Elapsed
+
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	suites.Time = junitTime(totalTime)
+
+	return suites
+}
+
+// writeJUnit writes the run result as JUnit XML to 'filePath'
+func writeJUnit(filePath string, result RunResult) error {
+	data, err := xml.MarshalIndent(buildJUnit(result), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to build junit report: %w", err)
+	}
+
+	err = os.WriteFile(filePath, append([]byte(xml.Header), data...), 0o666)
+	if err != nil {
+		return fmt.Errorf("failed to write junit report: %w", err)
+	}
+
+	return nil
+}
+
+// junitOutputOf returns the output lines as system-out or nil if there are none
+func junitOutputOf(lines []string) *junitOutput {
+	if len(lines) == 0 {
+		return nil
+	}
+	return &junitOutput{Contents: strings.Join(lines, "\n")}
+}
+
+func junitTime(seconds float64) string {
+	return sf("%.3f", seconds)
+}
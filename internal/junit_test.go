@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildJUnit(t *testing.T) {
+	result := RunResult{
+		Packages: []PackageResult{
+			{Name: "one", Status: "fail", Elapsed: 0.5, Coverage: "50.0%"},
+			{Name: "two", Status: "fail", FailedBuild: true, Output: []string{"# two", "code.go:2:10: undefined: x"}},
+		},
+		Tests: []TestResult{
+			{Package: "one", Name: "TestGood/sub", Status: "pass", Elapsed: 0.1},
+			{Package: "one", Name: "TestGood", Status: "pass", Elapsed: 0.2},
+			{Package: "one", Name: "TestBad", Status: "fail", Elapsed: 0.1, Output: []string{"    code_test.go:12: nope"}},
+			{Package: "one", Name: "TestPanic", Status: "fail", Output: []string{"panic: boom"}},
+			{Package: "one", Name: "TestSkip", Status: "skip", Output: []string{"    code_test.go:20: later"}},
+		},
+	}
+
+	suites := buildJUnit(result)
+
+	assert.Equal(t, 6, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	assert.Equal(t, 2, suites.Errors)
+	assert.Equal(t, 1, suites.Skipped)
+	assert.Equal(t, "0.500", suites.Time)
+	assert.Len(t, suites.Suites, 2)
+
+	one := suites.Suites[0]
+	assert.Equal(t, "one", one.Name)
+	assert.Equal(t, &junitProperties{[]junitProperty{{Name: "coverage", Value: "50.0%"}}}, one.Properties)
+	assert.Equal(t, []junitTestCase{
+		{ClassName: "one", Name: "TestGood/sub", Time: "0.100"},
+		{ClassName: "one", Name: "TestGood", Time: "0.200"},
+		{ClassName: "one", Name: "TestBad", Time: "0.100", Failure: &junitMessage{Message: "Failed", Contents: "    code_test.go:12: nope"}},
+		{ClassName: "one", Name: "TestPanic", Time: "0.000", Error: &junitMessage{Message: "Panicked", Contents: "panic: boom"}},
+		{ClassName: "one", Name: "TestSkip", Time: "0.000", Skipped: &junitMessage{Message: "code_test.go:20: later"}},
+	}, one.TestCases)
+
+	two := suites.Suites[1]
+	assert.Equal(t, []junitTestCase{
+		{ClassName: "two", Name: "[build failed]", Time: "0.000", Error: &junitMessage{Message: "[build failed]", Contents: "# two\ncode.go:2:10: undefined: x"}},
+	}, two.TestCases)
+
+	_, err := xml.Marshal(suites)
+	assert.NoError(t, err)
+}
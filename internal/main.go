@@ -29,19 +29,37 @@ type RunTestsOpts struct {
 	FlagSkipEmpty    bool
 	FlagListEmpty    bool
 	FlagFullCoverage bool
+	Includes         []string
 	Excludes         []string
+	Packages         map[string]PackageConf
 	FlagTestOutput   string
-
-	Azure AzureConf
+	FlagJUnit        string
+	FlagCobertura    string
+	FlagSummaryJSON  string
+	FlagTemplate     string
+	FlagTemplateOut  string
+	CommentTemplate  string
+	FlagBaseline     string
+	Notify           []NotifyConf
+	Publish          PublishConf
+	Version          string
+
+	Azure     AzureConf
+	Bitbucket BitbucketConf
+	Gitea     GiteaConf
+	GitHub    GitHubConf
+	GitLab    GitLabConf
 }
 
 type TestEvent struct {
-	Time    time.Time // encodes as an RFC3339-format string
-	Action  string
-	Package string
-	Test    string
-	Elapsed float64 // seconds
-	Output  string
+	Time        time.Time // encodes as an RFC3339-format string
+	Action      string
+	Package     string
+	Test        string
+	Elapsed     float64 // seconds
+	Output      string
+	ImportPath  string // set on build-output events
+	FailedBuild string // set on package fail events when the build failed
 }
 
 type Package struct {
@@ -50,16 +68,67 @@ type Package struct {
 	Name       string
 }
 
+// Default report paths when running in GitLab CI or Azure Pipelines, which render them in merge/pull requests
+const (
+	ciJUnitFile     = "gotestiful-junit.xml"
+	ciCoberturaFile = "gotestiful-cobertura.xml"
+)
+
 var ErrTestRunIgnore = errors.New("test run error")
 
 func RunTests(opts RunTestsOpts) error {
 	color.NoColor = !opts.FlagColor
 
+	// GitLab and Azure Pipelines render the JUnit and Cobertura reports in merge/pull requests
+	if opts.GitLab.CI || opts.Azure.Pipelines {
+		opts.FlagJUnit = zvfb(opts.FlagJUnit, ciJUnitFile)
+		opts.FlagCobertura = zvfb(opts.FlagCobertura, ciCoberturaFile)
+	}
+
+	err := opts.Publish.validate()
+	if err != nil {
+		return err
+	}
+	opts.GitHub.Publish = opts.Publish
+	opts.GitLab.Publish = opts.Publish
+	opts.Azure.Publish = opts.Publish
+	opts.Bitbucket.Publish = opts.Publish
+	opts.Gitea.Publish = opts.Publish
+
+	publisher, err := selectPublisher(opts)
+	if err != nil {
+		return err
+	}
+
+	// Parse the templates before running the tests so mistakes are reported right away
+	userTmpl, err := loadTemplate(opts.FlagTemplate)
+	if err != nil {
+		return err
+	}
+	commentTmpl, err := loadTemplate(opts.CommentTemplate)
+	if err != nil {
+		return err
+	}
+	baseline, err := loadSummary(opts.FlagBaseline)
+	if err != nil {
+		return err
+	}
+
 	// function to inject that actually "prints" each line
 	lineOut := func(str ...string) { fmt.Println(strings.Join(str, " ")) }
 
 	// Get packages to test
-	testPkgsMap, testPkgs, ignoredPkgs, err := getPackages(opts.TestPath, opts.Excludes)
+	testPkgsMap, testPkgs, ignoredPkgs, ignoredRules, err := getPackages(opts.TestPath, opts.Includes, opts.Excludes)
+	if err != nil {
+		return err
+	}
+
+	// Group the packages by their 'packages' settings, each group is tested by its own 'go test' run
+	pwd, err := getPWD()
+	if err != nil {
+		return err
+	}
+	groups, pkgConfs, err := groupPackages(testPkgs, testPkgsMap, opts.Packages, moduleRoot(pwd))
 	if err != nil {
 		return err
 	}
@@ -81,7 +150,7 @@ func RunTests(opts RunTestsOpts) error {
 
 	// Determine cover-profile file name
 	var coverProfile string
-	if opts.FlagCoverReport || opts.FlagFullCoverage {
+	if opts.FlagCoverReport || opts.FlagFullCoverage || opts.FlagCobertura != "" {
 		coverProfile = opts.FlagCoverProfile
 		// If empty use throw-away coverage profile
 		if coverProfile == "" {
@@ -94,28 +163,54 @@ func RunTests(opts RunTestsOpts) error {
 		}
 	}
 
+	reporters := []Reporter{
+		&terminalReporter{
+			LineOut:         lineOut,
+			ToTestPackages:  testPkgs,
+			FlagVerbose:     opts.FlagVerbose,
+			FlagSkipEmpty:   opts.FlagSkipEmpty,
+			FlagListEmpty:   opts.FlagListEmpty,
+			FlagListIgnored: opts.FlagListIgnored,
+			IgnoredRules:    ignoredRules,
+			GitHubGroups:    opts.GitHub.Actions,
+			IndentSpaces:    2,
+		},
+	}
+	reporters = sliceAppendIf[Reporter](opts.FlagJUnit != "", reporters, junitReporter{filePath: opts.FlagJUnit})
+	reporters = sliceAppendIf[Reporter](opts.FlagCobertura != "", reporters, coberturaReporter{filePath: opts.FlagCobertura, coverProfile: coverProfile, pkgsMap: testPkgsMap})
+	info := summaryInfo{version: opts.Version, module: getModule(), coverProfile: coverProfile, baseline: baseline}
+	reporters = sliceAppendIf[Reporter](opts.FlagSummaryJSON != "", reporters, summaryJSONReporter{filePath: opts.FlagSummaryJSON, info: info})
+	reporters = sliceAppendIf[Reporter](userTmpl != nil, reporters, templateReporter{tmpl: userTmpl, info: info, filePath: opts.FlagTemplateOut, lineOut: lineOut})
+	comment := commentTemplate{tmpl: commentTmpl, info: info}
+	notify, err := newNotifyReporter(opts.Notify, info, opts.Publish)
+	if err != nil {
+		return err
+	}
+	reporters = append(reporters,
+		githubReporter{conf: opts.GitHub, pkgsMap: testPkgsMap, lineOut: lineOut},
+		gitlabReporter{conf: opts.GitLab, lineOut: lineOut},
+		azureReporter{conf: opts.Azure, pkgsMap: testPkgsMap, junitFile: opts.FlagJUnit, coberturaFile: opts.FlagCobertura, lineOut: lineOut},
+		publishReporter{publisher: publisher, required: opts.Publish.Required, comment: comment, pkgsMap: testPkgsMap, lineOut: lineOut},
+		notify,
+	)
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 
 	goTestOutput := make(chan TestEvent) // channel to receive each 'go test' stdout line
-	var failedTests []string
-	var totalCoverage float64
+	var result RunResult
+	var reportErr error
 
 	go func() {
-		processOutput(&processOutputParams{
+		result, reportErr = processOutput(&processOutputParams{
 			OutputChannel:   goTestOutput,
-			LineOut:         lineOut,
 			ToTestPackages:  testPkgs,
 			IgnoredPackages: ignoredPkgs,
-			FlagVerbose:     opts.FlagVerbose,
-			FlagSkipEmpty:   opts.FlagSkipEmpty,
-			FlagListEmpty:   opts.FlagListEmpty,
-			FlagListIgnored: opts.FlagListIgnored,
-			IndentSpaces:    2,
 			NoTestsPackages: newPackages,
+			FlagSkipEmpty:   opts.FlagSkipEmpty,
 			CoverProfile:    coverProfile,
-			FailedTests:     &failedTests,
-			TotalCoverage:   &totalCoverage,
+			PackageConfs:    pkgConfs,
+			Reporters:       reporters,
 		})
 		wg.Done()
 	}()
@@ -129,22 +224,23 @@ func RunTests(opts RunTestsOpts) error {
 		testOut = file
 	}
 
-	// Compose and run 'go test ...'
+	// Compose and run 'go test ...', one run per packages group streaming into the same output
 	lineOut(sf("\nTesting %d packages in '%s'\n", len(testPkgs), opts.TestPath))
-	testArgs := shArgs{"test"}
-	testArgs = sliceAppendIf(opts.FlagVerbose, testArgs, "-v")
-	testArgs = sliceAppendIf(!opts.FlagCache, testArgs, "-count=1")
-	testArgs = sliceAppendIf(opts.FlagCover, testArgs, "-cover")
-	testArgs = sliceAppendIf(coverProfile != "", testArgs, "-coverprofile="+coverProfile)
-	testArgs = append(testArgs, "-json")
-	testArgs = append(testArgs, testPkgs...)
-	testErr := shJSONPipe("go", testArgs, "", goTestOutput, testOut)
+	testErr := runTestGroups(groups, opts, coverProfile, goTestOutput, testOut)
 	wg.Wait()
 
-	// Publish Azure Coverage PR comment
-	opts.Azure.sendAzureComment(totalCoverage, failedTests)
+	if reportErr != nil {
+		return reportErr
+	}
 
-	if testErr != nil {
+	if len(result.BelowCoverage) > 0 {
+		lineOut(shColor("red", "\nPackages below their coverage threshold:"))
+		for _, b := range result.BelowCoverage {
+			lineOut("- " + b)
+		}
+	}
+
+	if testErr != nil || len(result.BelowCoverage) > 0 {
 		return ErrTestRunIgnore
 	}
 
@@ -158,7 +254,65 @@ func RunTests(opts RunTestsOpts) error {
 
 // Helpers --------------
 
-func getPackages(testPath string, excludes []string) (map[string]Package, []string, []string, error) {
+// runTestGroups runs 'go test' for each packages group concurrently, sending the events of all runs to 'output'.
+// The runs write their own cover profile, merged into 'coverProfile' before the output is closed.
+func runTestGroups(groups []packageGroup, opts RunTestsOpts, coverProfile string, output chan<- TestEvent, testOut io.Writer) error {
+	defer close(output)
+
+	var wg sync.WaitGroup
+	var outMu sync.Mutex
+	errs := make([]error, len(groups))
+	profiles := make([]string, len(groups))
+
+	coverMode := ""
+	if len(groups) > 1 && (opts.FlagCover || coverProfile != "") {
+		var err error
+		if coverMode, err = getCoverMode(groups); err != nil {
+			return err
+		}
+	}
+
+	for i, group := range groups {
+		profiles[i] = ifelse(len(groups) > 1 && coverProfile != "", sf("%s.%d", coverProfile, i), coverProfile)
+
+		testArgs := shArgs{"test"}
+		testArgs = sliceAppendIf(opts.FlagVerbose, testArgs, "-v")
+		testArgs = sliceAppendIf(opts.FlagCover, testArgs, "-cover")
+		testArgs = sliceAppendIf(coverProfile != "", testArgs, "-coverprofile="+profiles[i])
+		testArgs = sliceAppendIf(coverMode != "", testArgs, "-covermode="+coverMode)
+		testArgs = append(testArgs, group.conf.testArgs(opts.FlagCache)...)
+		testArgs = append(testArgs, "-json")
+		testArgs = append(testArgs, group.pkgs...)
+
+		wg.Add(1)
+		go func(i int, env []string) {
+			errs[i] = shJSONStream("go", testArgs, env, output, &lineWriter{mu: &outMu, w: testOut})
+			wg.Done()
+		}(i, group.conf.environ())
+	}
+	wg.Wait()
+
+	if len(groups) > 1 && coverProfile != "" {
+		err := mergeCoverProfiles(coverProfile, profiles)
+		for _, p := range profiles {
+			os.Remove(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPackages lists the packages of 'testPath' and selects the ones to test with the include/exclude rules.
+// Returns the packages to test (and a map of them), the ignored packages and the rule that excluded each one.
+func getPackages(testPath string, includes, excludes []string) (map[string]Package, []string, []string, map[string]string, error) {
 	allPkgs := []string{}
 	allPkgsMap := map[string]Package{}
 
@@ -177,13 +331,17 @@ func getPackages(testPath string, excludes []string) (map[string]Package, []stri
 	err := shJSONPipe("go", shArgs{"list", "-json", testPath}, "", pkgChan, io.Discard)
 	wg.Wait()
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
-	// Exclude packages to ignore
-	pkgsToTest, pkgsIgnored, err := excludePackages(allPkgs, excludes)
+	// Exclude packages to ignore, directory patterns are relative to the module root
+	pwd, err := getPWD()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	pkgsToTest, pkgsIgnored, ignoredRules, err := excludePackages(allPkgs, allPkgsMap, includes, excludes, moduleRoot(pwd))
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	// Build packages to test map
@@ -192,7 +350,16 @@ func getPackages(testPath string, excludes []string) (map[string]Package, []stri
 		pkgsToTestMap[pkg] = allPkgsMap[pkg]
 	}
 
-	return pkgsToTestMap, pkgsToTest, pkgsIgnored, nil
+	return pkgsToTestMap, pkgsToTest, pkgsIgnored, ignoredRules, nil
+}
+
+// getModule returns the path of the main module (or empty if it cannot be determined)
+func getModule() string {
+	out, err := shCmd("go", shArgs{"list", "-m"}, "")
+	if err != nil {
+		return ""
+	}
+	return sliceAt(splitLines(out), 0, "")
 }
 
 // "Eliminate" no-tests pakages by creating blank test file in them
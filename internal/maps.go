@@ -1,7 +1,30 @@
 package internal
 
+import (
+	"sort"
+
+	"golang.org/x/exp/constraints"
+	"golang.org/x/exp/maps"
+)
+
 // mapHasKey returns true if a map has the key provided
 func mapHasKey[K comparable, V any](m map[K]V, key K) bool {
 	_, ok := m[key]
 	return ok
 }
+
+// mapSortedKeys returns the keys of a map in ascending order
+func mapSortedKeys[K constraints.Ordered, V any](m map[K]V) []K {
+	keys := maps.Keys(m)
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// mapMerge returns a new map with the entries of all maps, later maps overriding the earlier
+func mapMerge[K comparable, V any](ms ...map[K]V) map[K]V {
+	merged := map[K]V{}
+	for _, m := range ms {
+		maps.Copy(merged, m)
+	}
+	return merged
+}
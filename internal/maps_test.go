@@ -19,3 +19,22 @@ func TestMapHasKey(t *testing.T) {
 		assert.True(t, actual)
 	})
 }
+
+func TestMapSortedKeys(t *testing.T) {
+	t.Run("empty map", func(t *testing.T) {
+		assert.Empty(t, mapSortedKeys(map[string]bool{}))
+	})
+
+	t.Run("sorted keys", func(t *testing.T) {
+		m := map[string]int{"world": 1, "hello": 2, "foo": 3}
+		assert.Equal(t, []string{"foo", "hello", "world"}, mapSortedKeys(m))
+	})
+}
+
+func TestMapMerge(t *testing.T) {
+	assert.Empty(t, mapMerge[string, int]())
+	assert.Equal(t,
+		map[string]int{"a": 1, "b": 3, "c": 4},
+		mapMerge(map[string]int{"a": 1, "b": 2}, map[string]int{"b": 3, "c": 4}),
+	)
+}
@@ -0,0 +1,517 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configVersion is the current config format. Files without 'version' are version 1, they are migrated when loaded.
+const configVersion = 2
+
+// deprecationWarnings are the warnings shown, the config may be loaded more than once per run
+var deprecationWarnings sync.Map
+
+// warnDeprecated prints the deprecation warning 'msg' once
+func warnDeprecated(msg string) {
+	if _, shown := deprecationWarnings.LoadOrStore(msg, true); !shown {
+		fmt.Fprintln(os.Stderr, "WARN: "+msg)
+	}
+}
+
+// WarnDeprecatedFlag prints the deprecation warning of the command line flag 'name', 'hint' tells what to use instead
+func WarnDeprecatedFlag(name, hint string) {
+	warnDeprecated(sf("-%s is deprecated, %s", name, hint))
+}
+
+// configMigration upgrades a config from version 'from' to the next one, editing the mapping 'node' in place so the keys keep their order.
+// Returns if the config had keys to migrate.
+type configMigration struct {
+	from    int
+	migrate func(node *yaml.Node) bool
+}
+
+var configMigrations = []configMigration{
+	{from: 1, migrate: migrateSections},
+}
+
+// configMove is a key moved into a section, renamed to 'name'
+type configMove struct {
+	key, section, name string
+}
+
+// configV1Moves are the flat version 1 keys moved into the 'output' and 'coverage' sections in version 2
+var configV1Moves = []configMove{
+	{"color", "output", "color"},
+	{"verbose", "output", "verbose"},
+	{"listIgnored", "output", "listIgnored"},
+	{"skipEmpty", "output", "skipEmpty"},
+	{"listEmpty", "output", "listEmpty"},
+	{"cover", "coverage", "enabled"},
+	{"report", "coverage", "report"},
+	{"coverProfile", "coverage", "profile"},
+	{"fullCoverage", "coverage", "full"},
+}
+
+// migrateSections moves the version 1 keys into their section, which takes the place (and the comment) of its first key.
+// Profiles are migrated too.
+func migrateSections(node *yaml.Node) bool {
+	changed := false
+
+	// in the document order, so each section goes where its first key was
+	moves := []configMove{}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		for _, m := range configV1Moves {
+			if node.Content[i].Value == m.key {
+				moves = append(moves, m)
+			}
+		}
+	}
+
+	for _, m := range moves {
+		i := nodeKeyIndex(node, m.key)
+
+		key, val := node.Content[i], node.Content[i+1]
+		node.Content = append(node.Content[:i], node.Content[i+2:]...)
+
+		section := nodeKeyIndex(node, m.section)
+		if section < 0 {
+			section = i
+			sectionKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: m.section, Style: key.Style, HeadComment: key.HeadComment}
+			key.HeadComment = ""
+			node.Content = append(node.Content[:i], append([]*yaml.Node{sectionKey, {Kind: yaml.MappingNode, Tag: "!!map"}}, node.Content[i:]...)...)
+		}
+
+		key.Value = m.name
+		node.Content[section+1].Content = append(node.Content[section+1].Content, key, val)
+		changed = true
+	}
+
+	if i := nodeKeyIndex(node, "profiles"); i >= 0 {
+		profiles := node.Content[i+1]
+		for j := 1; j < len(profiles.Content); j += 2 {
+			if profiles.Content[j].Kind == yaml.MappingNode {
+				changed = migrateSections(profiles.Content[j]) || changed
+			}
+		}
+	}
+
+	return changed
+}
+
+// legacyConfigKey returns the version 1 key of a moved 'key' eg. 'cover' for 'coverage.enabled', empty if it was not moved
+func legacyConfigKey(key string) string {
+	for _, m := range configV1Moves {
+		if m.section+"."+m.name == key {
+			return m.key
+		}
+	}
+	return ""
+}
+
+// nodeKeyIndex returns the index of 'key' in the mapping 'node' content, -1 if not found
+func nodeKeyIndex(node *yaml.Node, key string) int {
+	if node.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// migrateConfigNode upgrades the config mapping 'root' to the current version and sets its 'version'.
+// Returns the version it had and if it had keys to migrate.
+func migrateConfigNode(root *yaml.Node) (int, bool, error) {
+	version := 1
+	versionIdx := nodeKeyIndex(root, "version")
+	if versionIdx >= 0 {
+		v, err := strconv.Atoi(root.Content[versionIdx+1].Value)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid config version %q", root.Content[versionIdx+1].Value)
+		}
+		version = v
+	}
+
+	if version > configVersion {
+		return 0, false, fmt.Errorf("config version %d is newer than the supported %d, upgrade gotestiful", version, configVersion)
+	}
+	if version == configVersion {
+		return version, false, nil
+	}
+
+	changed := false
+	for _, m := range configMigrations {
+		if m.from >= version {
+			changed = m.migrate(root) || changed
+		}
+	}
+
+	versionNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(configVersion)}
+	if versionIdx >= 0 {
+		root.Content[versionIdx+1] = versionNode
+	} else {
+		// first, after the '$schema' reference
+		i := ifelse(nodeKeyIndex(root, "$schema") == 0, 2, 0)
+		versionKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		if i == 0 && len(root.Content) > 0 {
+			// keep the file header comments on top
+			versionKey.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+		}
+		root.Content = append(root.Content[:i], append([]*yaml.Node{versionKey, versionNode}, root.Content[i:]...)...)
+	}
+
+	return version, changed, nil
+}
+
+// parseConfigNode parses the config file 'data' into a document node, which keeps the keys order (and the YAML comments)
+func parseConfigNode(confPath string, data []byte) (*yaml.Node, error) {
+	var root *yaml.Node
+
+	switch configFormat(confPath) {
+	case "yaml":
+		var doc yaml.Node
+		err := yaml.Unmarshal(data, &doc)
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) > 0 {
+			root = doc.Content[0]
+			if root.Kind != yaml.MappingNode {
+				return nil, errors.New("the config must be a mapping of keys")
+			}
+			return &doc, nil
+		}
+
+	case "toml":
+		var values map[string]any
+		md, err := toml.Decode(string(data), &values)
+		if err != nil {
+			return nil, err
+		}
+		order := map[string]int{}
+		for i, key := range md.Keys() {
+			path := strings.Join(key, "\x00")
+			if _, ok := order[path]; !ok {
+				order[path] = i
+			}
+		}
+		root = tomlNode(values, "", order)
+
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var err error
+		root, err = jsonNode(dec)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, errors.New("invalid data after the top-level value")
+		}
+		if root.Kind != yaml.MappingNode {
+			return nil, errors.New("the config must be an object")
+		}
+	}
+
+	if root == nil {
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+// jsonNode reads the next JSON value of 'dec' (with UseNumber) as a node
+func jsonNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if t == '[' {
+			node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			val, err := jsonNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, val)
+		}
+		_, err = dec.Token() // closing delimiter
+		return node, err
+
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	case json.Number:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: ifelse(strings.ContainsAny(t.String(), ".eE"), "!!float", "!!int"), Value: t.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// tomlNode converts a decoded TOML value to a node, the tables keys in the document order ('order' of each key path)
+func tomlNode(v any, path string, order map[string]int) *yaml.Node {
+	switch val := v.(type) {
+	case map[string]any:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		keys := mapSortedKeys(val)
+		sort.SliceStable(keys, func(i, j int) bool {
+			return order[strings.TrimPrefix(path+"\x00"+keys[i], "\x00")] < order[strings.TrimPrefix(path+"\x00"+keys[j], "\x00")]
+		})
+		for _, k := range keys {
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
+			node.Content = append(node.Content, key, tomlNode(val[k], strings.TrimPrefix(path+"\x00"+k, "\x00"), order))
+		}
+		return node
+
+	case []map[string]any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range val {
+			node.Content = append(node.Content, tomlNode(item, path, order))
+		}
+		return node
+
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range val {
+			node.Content = append(node.Content, tomlNode(item, path, order))
+		}
+		return node
+
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(val)}
+	case int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(val, 10)}
+	case float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(val, 'g', -1, 64)}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: sf("%v", val)}
+	}
+}
+
+// writeJSONNode writes 'node' as indented JSON, like json.MarshalIndent with two spaces
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node, indent string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		writeJSONNode(buf, node.Content[0], indent)
+
+	case yaml.AliasNode:
+		writeJSONNode(buf, node.Alias, indent)
+
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, close, step = "{", "}", 2
+		}
+		if len(node.Content) == 0 {
+			buf.WriteString(open + close)
+			return
+		}
+
+		buf.WriteString(open + "\n")
+		for i := 0; i < len(node.Content); i += step {
+			buf.WriteString(indent + "  ")
+			if step == 2 {
+				key, _ := json.Marshal(node.Content[i].Value)
+				buf.Write(key)
+				buf.WriteString(": ")
+			}
+			writeJSONNode(buf, node.Content[i+step-1], indent+"  ")
+			buf.WriteString(ifelse(i+step < len(node.Content), ",\n", "\n"))
+		}
+		buf.WriteString(indent + close)
+
+	default:
+		switch node.ShortTag() {
+		case "!!str":
+			value, _ := json.Marshal(node.Value)
+			buf.Write(value)
+		case "!!null":
+			buf.WriteString("null")
+		default:
+			buf.WriteString(node.Value)
+		}
+	}
+}
+
+// encodeConfigNode formats the config document 'doc' as json, yaml or toml. 'header' are the leading comment lines of TOML files.
+func encodeConfigNode(doc *yaml.Node, format, header string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "yaml":
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err := enc.Encode(doc)
+		if err != nil {
+			return nil, err
+		}
+
+	case "toml":
+		buf.WriteString(header)
+		var table bytes.Buffer
+		writeTOMLTable(&table, "", "", doc.Content[0])
+		buf.Write(bytes.TrimLeft(table.Bytes(), "\n"))
+
+	default:
+		writeJSONNode(&buf, doc, "")
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// tomlHeader returns the leading comment lines of a TOML file eg. the '#:schema' reference, its parser drops the comments
+func tomlHeader(data []byte) string {
+	var header strings.Builder
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			break
+		}
+		header.WriteString(strings.TrimRight(line, "\n") + "\n")
+	}
+	return header.String()
+}
+
+// tomlHasComments tells if the TOML 'data' has comments after its header, which the rewrite would drop.
+// A '#' in a multiline string counts too, refusing the rewrite is the safe side.
+func tomlHasComments(data []byte) bool {
+	lines := strings.Split(string(data), "\n")[strings.Count(tomlHeader(data), "\n"):]
+	for _, line := range lines {
+		quote, escaped := rune(0), false
+		for _, r := range line {
+			switch {
+			case escaped:
+				escaped = false
+			case quote == '"' && r == '\\':
+				escaped = true
+			case quote != 0:
+				if r == quote {
+					quote = 0
+				}
+			case r == '"' || r == '\'':
+				quote = r
+			case r == '#':
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// migrateConfigFile upgrades the config file at 'confPath' to the current version, keeping its values and keys order.
+// Returns the version it had, and if it was rewritten.
+func migrateConfigFile(confPath string) (int, bool, error) {
+	data, err := readFile(confPath)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	doc, err := parseConfigNode(confPath, data)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read config file %s: %w", confPath, err)
+	}
+
+	from, _, err := migrateConfigNode(doc.Content[0])
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to migrate config file %s: %w", confPath, err)
+	}
+	if from == configVersion {
+		return from, false, nil
+	}
+
+	// check the migrated config loads before replacing the file
+	var values map[string]any
+	err = doc.Content[0].Decode(&values)
+	if err == nil {
+		delete(values, "$schema")
+		data, _ := json.Marshal(values)
+		var c config
+		_, err = decodeConfig(data, &c)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to migrate config file %s: %w", confPath, err)
+	}
+
+	format := configFormat(confPath)
+	migrated, err := encodeConfigNode(doc, format, ifelse(format == "toml", tomlHeader(data), ""))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to migrate config file %s: %w", confPath, err)
+	}
+
+	if format == "toml" && tomlHasComments(data) {
+		return 0, false, fmt.Errorf("config file %s not migrated, its comments would be lost. replace its content with:\n\n%s", confPath, migrated)
+	}
+
+	err = os.WriteFile(confPath, migrated, 0644)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to migrate config file %s: %w", confPath, err)
+	}
+
+	return from, true, nil
+}
+
+// MigrateConfig upgrades the project and global config files to the current format, keeping the values, keys order and YAML comments.
+// TOML files with comments past the header are not rewritten, the error has the migrated content to apply by hand.
+func MigrateConfig() error {
+	pwd, err := getPWD()
+	if err != nil {
+		return err
+	}
+
+	projectPath, err := findProjectConfigFile(pwd)
+	if err != nil {
+		return err
+	}
+	globalPath, err := findGlobalConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if projectPath == "" && globalPath == "" {
+		return errors.New("no config file found, run 'gotestiful init' to create one")
+	}
+
+	for _, confPath := range []string{projectPath, globalPath} {
+		if confPath == "" {
+			continue
+		}
+
+		from, migrated, err := migrateConfigFile(confPath)
+		if err != nil {
+			return err
+		}
+
+		if migrated {
+			fmt.Printf("Migrated %s from version %d to %d\n", confPath, from, configVersion)
+		} else {
+			fmt.Printf("%s is up to date (version %d)\n", confPath, configVersion)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateConfigNode(t *testing.T) {
+	t.Parallel()
+
+	doc, err := parseConfigNode(configFileName, []byte(`{"$schema": "s", "exclude": [], "verbose": true, "cover": false, "color": false, "fullCoverage": true, "profiles": {"ci": {"color": false}}}`))
+	assert.NoError(t, err)
+
+	from, changed, err := migrateConfigNode(doc.Content[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, from)
+	assert.True(t, changed)
+
+	data, err := encodeConfigNode(doc, "json", "")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"$schema": "s", "version": 2, "exclude": [], "output": {"verbose": true, "color": false}, "coverage": {"enabled": false, "full": true}, "profiles": {"ci": {"output": {"color": false}}}}`, string(data))
+
+	keys := []string{}
+	for i := 0; i < len(doc.Content[0].Content); i += 2 {
+		keys = append(keys, doc.Content[0].Content[i].Value)
+	}
+	assert.Equal(t, []string{"$schema", "version", "exclude", "output", "coverage", "profiles"}, keys, "sections take the place of their first key")
+
+	from, changed, err = migrateConfigNode(doc.Content[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, from)
+	assert.False(t, changed)
+
+	for content, msg := range map[string]string{
+		`{"version": 3}`:   "config version 3 is newer than the supported 2, upgrade gotestiful",
+		`{"version": "x"}`: `invalid config version "x"`,
+	} {
+		doc, err := parseConfigNode(configFileName, []byte(content))
+		assert.NoError(t, err)
+		_, _, err = migrateConfigNode(doc.Content[0])
+		assert.EqualError(t, err, msg)
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	t.Parallel()
+
+	files := map[string][2]string{
+		".gotestiful": {
+			`{"cover": true, "report": false, "exclude": ["mod/gen"], "color": false}`,
+			`{
+  "version": 2,
+  "coverage": {
+    "enabled": true,
+    "report": false
+  },
+  "exclude": [
+    "mod/gen"
+  ],
+  "output": {
+    "color": false
+  }
+}
+`,
+		},
+		".gotestiful.yaml": {
+			`# yaml-language-server: $schema=s
+color: false # no colors in CI
+exclude:
+  - mod/gen # generated protobuf
+`,
+			`# yaml-language-server: $schema=s
+version: 2
+output:
+  color: false # no colors in CI
+exclude:
+  - mod/gen # generated protobuf
+`,
+		},
+		".gotestiful.toml": {
+			`#:schema s
+color = false
+exclude = ["mod/gen"]
+`,
+			`#:schema s
+version = 2
+exclude = ["mod/gen"]
+
+[output]
+color = false
+`,
+		},
+	}
+
+	for name, file := range files {
+		name, file := name, file
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), name)
+			assert.NoError(t, os.WriteFile(path, []byte(file[0]), 0o666))
+
+			from, migrated, err := migrateConfigFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, from)
+			assert.True(t, migrated)
+
+			data, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, file[1], string(data))
+
+			from, migrated, err = migrateConfigFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, from)
+			assert.False(t, migrated, "up to date")
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), ".gotestiful.toml")
+	commented := "#:schema s\ncolor = false # no colors in CI\nexclude = [\"mod/gen\"]\n"
+	assert.NoError(t, os.WriteFile(path, []byte(commented), 0o666))
+	_, _, err := migrateConfigFile(path)
+	assert.EqualError(t, err, "config file "+path+" not migrated, its comments would be lost. replace its content with:\n\n"+files[".gotestiful.toml"][1])
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, commented, string(data), "not rewritten")
+
+	path = filepath.Join(t.TempDir(), configFileName)
+	assert.NoError(t, os.WriteFile(path, []byte(`{"colour": false}`), 0o666))
+	_, _, err = migrateConfigFile(path)
+	assert.EqualError(t, err, "failed to migrate config file "+path+`: unknown field "colour"`)
+	data, _ = os.ReadFile(path)
+	assert.Equal(t, `{"colour": false}`, string(data), "not rewritten")
+}
+
+func TestReadConfigFileVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".gotestiful.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("color: false\ncover: false\nprofiles:\n  ci:\n    verbose: true\n"), 0o666))
+
+	c := conf
+	keys, err := readConfigFile(path, &c)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"output.color", "coverage.enabled", "profiles"}, keys)
+	assert.False(t, c.Output.Color)
+	assert.False(t, c.Coverage.Enabled)
+	assert.JSONEq(t, `{"output": {"verbose": true}}`, string(c.Profiles["ci"]))
+}
+
+func TestTomlHasComments(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, tomlHasComments([]byte("#:schema s\n# header\ncolor = false\n")), "header")
+	assert.False(t, tomlHasComments([]byte(`exclude = ["mod/#gen", 'a#b', "q\"#"]`)), "in strings")
+	assert.True(t, tomlHasComments([]byte("color = false # no colors\n")))
+	assert.True(t, tomlHasComments([]byte("#:schema s\n\n# output\ncolor = false\n")), "past the header")
+}
+
+func TestLegacyConfigKey(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "cover", legacyConfigKey("coverage.enabled"))
+	assert.Equal(t, "coverProfile", legacyConfigKey("coverage.profile"))
+	assert.Equal(t, "", legacyConfigKey("cache"))
+	assert.Equal(t, -1, nodeKeyIndex(&yaml.Node{Kind: yaml.ScalarNode}, "cover"))
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// NotifyConf is a webhook endpoint notified once the run is done (eg. Slack, Teams or Mattermost)
+type NotifyConf struct {
+	Name           string            `json:"name"`           // shown in errors, defaults to the url host
+	URL            string            `json:"url"`            // ${ENV} variables are expanded
+	Method         string            `json:"method"`         // defaults to POST
+	Headers        map[string]string `json:"headers"`        // ${ENV} variables are expanded eg. "Authorization": "Bearer ${TOKEN}"
+	Body           string            `json:"body"`           // JSON text/template over the run summary, defaults to the json summary
+	OnFailure      bool              `json:"onFailure"`      // notify when tests fail
+	OnCoverageDrop bool              `json:"onCoverageDrop"` // notify when the total coverage is lower than the baseline
+	Timeout        string            `json:"timeout"`        // per attempt eg. "5s", defaults to the 'publish' timeout
+	Attempts       int               `json:"attempts"`       // attempts on network errors, 5xx and 429, defaults to the 'publish' attempts
+}
+
+// notifyReporter sends the webhooks whose conditions are met
+type notifyReporter struct {
+	nopReporter
+	hooks     []NotifyConf
+	templates []*template.Template // body template of each hook, nil for the json summary
+	info      summaryInfo
+	publish   PublishConf
+}
+
+// newNotifyReporter parses the hooks body templates and settings so mistakes are reported before running the tests
+func newNotifyReporter(hooks []NotifyConf, info summaryInfo, publish PublishConf) (notifyReporter, error) {
+	r := notifyReporter{hooks: hooks, info: info, publish: publish}
+
+	for _, hook := range hooks {
+		if hook.URL == "" {
+			return r, fmt.Errorf("notify %s: url is required", zvfb(hook.Name, "webhook"))
+		}
+
+		if hook.Timeout != "" {
+			if _, err := time.ParseDuration(hook.Timeout); err != nil {
+				return r, fmt.Errorf("notify %s: invalid timeout: %w", hook.name(), err)
+			}
+		}
+
+		if hook.OnCoverageDrop && info.baseline == nil {
+			return r, fmt.Errorf("notify %s: onCoverageDrop requires a baseline summary (-baseline)", hook.name())
+		}
+
+		var tmpl *template.Template
+		if hook.Body != "" {
+			var err error
+			tmpl, err = parseTemplate(hook.name(), hook.Body)
+			if err != nil {
+				return r, fmt.Errorf("notify %s: %w", hook.name(), err)
+			}
+		}
+		r.templates = append(r.templates, tmpl)
+	}
+
+	return r, nil
+}
+
+func (r notifyReporter) OnSummary(result RunResult) error {
+	if len(r.hooks) == 0 {
+		return nil
+	}
+
+	data := r.info.data(result)
+
+	// a failing hook does not stop the others
+	errs := []error{}
+	for i, hook := range r.hooks {
+		if !hook.shouldNotify(data.Summary, data.Baseline) {
+			continue
+		}
+
+		body, err := hook.body(r.templates[i], data)
+		if err == nil {
+			err = hook.send(body, r.publish)
+		}
+		errs = append(errs, err)
+	}
+
+	return joinErrors(errs)
+}
+
+func (n NotifyConf) name() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(n.URL, "https://"), "http://"), "/", 2)[0]
+}
+
+// shouldNotify checks the hook conditions. A hook without conditions is always notified, else any met condition is enough.
+func (n NotifyConf) shouldNotify(summary Summary, baseline *Summary) bool {
+	if !n.OnFailure && !n.OnCoverageDrop {
+		return true
+	}
+
+	failed := len(summary.FailedTests) > 0 || len(summary.BelowCoverage) > 0
+	for _, pkg := range summary.Packages {
+		failed = failed || pkg.Status == "fail"
+	}
+
+	return (n.OnFailure && failed) || (n.OnCoverageDrop && coverageDropped(summary, baseline))
+}
+
+// coverageDropped compares the total coverage to the baseline, rounded to the 2 decimals shown in the output
+func coverageDropped(summary Summary, baseline *Summary) bool {
+	if baseline == nil {
+		return false
+	}
+	return roundCoverage(summary.TotalCoverage) < roundCoverage(baseline.TotalCoverage)
+}
+
+// body renders the hook body template, or the json summary if there's no template
+func (n NotifyConf) body(tmpl *template.Template, data templateData) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(data.Summary)
+	}
+
+	out, err := renderTemplate(tmpl, data)
+	if err != nil {
+		return nil, fmt.Errorf("notify %s: %w", n.name(), err)
+	}
+
+	if !json.Valid([]byte(out)) {
+		return nil, fmt.Errorf("notify %s: body is not valid JSON (use the 'json' template function to quote values):\n%s", n.name(), out)
+	}
+
+	return []byte(out), nil
+}
+
+// send delivers the body, with the hook timeout and attempts overriding the 'publish' settings
+func (n NotifyConf) send(body []byte, publish PublishConf) error {
+	headers := map[string]string{}
+	for key, val := range n.Headers {
+		headers[key] = os.ExpandEnv(val)
+	}
+
+	return apiClient{
+		name:    "notify " + n.name(),
+		headers: headers,
+		conf: PublishConf{
+			Timeout:  zvfb(n.Timeout, publish.Timeout),
+			Attempts: zvfb(n.Attempts, publish.Attempts),
+			DryRun:   publish.DryRun,
+		},
+		urlLabel: n.URL, // before the ${ENV} expansion, webhook urls are often secret
+	}.request(zvfb(n.Method, http.MethodPost), os.ExpandEnv(n.URL), body, nil)
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyShouldNotify(t *testing.T) {
+	passed := Summary{TotalCoverage: 70, Packages: []SummaryPackage{{Name: "a", Status: "pass"}}}
+	failed := Summary{TotalCoverage: 70, Packages: []SummaryPackage{{Name: "a", Status: "fail"}}}
+	higher := &Summary{TotalCoverage: 80}
+	same := &Summary{TotalCoverage: 70.001}
+
+	assert.True(t, NotifyConf{}.shouldNotify(passed, nil))
+	assert.False(t, NotifyConf{OnFailure: true}.shouldNotify(passed, nil))
+	assert.True(t, NotifyConf{OnFailure: true}.shouldNotify(failed, nil))
+	assert.True(t, NotifyConf{OnCoverageDrop: true}.shouldNotify(passed, higher))
+	assert.False(t, NotifyConf{OnCoverageDrop: true}.shouldNotify(passed, same))
+	assert.True(t, NotifyConf{OnFailure: true, OnCoverageDrop: true}.shouldNotify(failed, same))
+}
+
+func TestNewNotifyReporter(t *testing.T) {
+	_, err := newNotifyReporter([]NotifyConf{{Name: "chat"}}, summaryInfo{}, PublishConf{})
+	assert.ErrorContains(t, err, "notify chat: url is required")
+
+	_, err = newNotifyReporter([]NotifyConf{{URL: "https://chat.example.com/hook", Timeout: "soon"}}, summaryInfo{}, PublishConf{})
+	assert.ErrorContains(t, err, "notify chat.example.com: invalid timeout")
+
+	_, err = newNotifyReporter([]NotifyConf{{URL: "https://chat.example.com", OnCoverageDrop: true}}, summaryInfo{}, PublishConf{})
+	assert.ErrorContains(t, err, "requires a baseline")
+
+	_, err = newNotifyReporter([]NotifyConf{{URL: "https://chat.example.com", Body: "{{.Nope"}}, summaryInfo{}, PublishConf{})
+	assert.ErrorContains(t, err, "failed to parse template")
+}
+
+func TestNotifyReporter(t *testing.T) {
+	fastBackoff(t)
+
+	type request struct {
+		Method, Path, Auth, Body string
+	}
+
+	stub := func(statuses ...int) (*httptest.Server, *[]request) {
+		requests := []request{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests = append(requests, request{r.Method, r.URL.Path, r.Header.Get("Authorization"), string(body)})
+			w.WriteHeader(sliceAt(statuses, len(requests)-1, http.StatusOK))
+			_, _ = w.Write([]byte("nope"))
+		}))
+		return server, &requests
+	}
+
+	result := RunResult{
+		Packages:      []PackageResult{{Name: "mod/a", Status: "fail"}},
+		Tests:         []TestResult{{Package: "mod/a", Name: "TestBad", Status: "fail"}},
+		TotalCoverage: 42,
+	}
+
+	t.Run("templated body and env headers", func(t *testing.T) {
+		t.Setenv("NOTIFY_TOKEN", "secret")
+		server, requests := stub()
+		defer server.Close()
+
+		r, err := newNotifyReporter([]NotifyConf{
+			{
+				URL:       server.URL + "/hook",
+				Headers:   map[string]string{"Authorization": "Bearer ${NOTIFY_TOKEN}"},
+				Body:      `{"text": {{json (printf "%s failed, coverage %s" .Module (percent .TotalCoverage))}}}`,
+				OnFailure: true,
+			},
+			{URL: server.URL + "/never", OnCoverageDrop: true},
+		}, summaryInfo{module: "mod", baseline: &Summary{TotalCoverage: 10}}, PublishConf{})
+		assert.NoError(t, err)
+
+		assert.NoError(t, r.OnSummary(result))
+		assert.Equal(t, []request{
+			{http.MethodPost, "/hook", "Bearer secret", `{"text": "mod failed, coverage 42.00%"}`},
+		}, *requests)
+	})
+
+	t.Run("default body", func(t *testing.T) {
+		server, requests := stub()
+		defer server.Close()
+
+		r, err := newNotifyReporter([]NotifyConf{{URL: server.URL, Method: http.MethodPut}}, summaryInfo{version: "v1"}, PublishConf{})
+		assert.NoError(t, err)
+		assert.NoError(t, r.OnSummary(result))
+
+		assert.Len(t, *requests, 1)
+		assert.Equal(t, http.MethodPut, (*requests)[0].Method)
+		var summary Summary
+		assert.NoError(t, json.Unmarshal([]byte((*requests)[0].Body), &summary))
+		assert.Equal(t, "v1", summary.Version)
+		assert.Equal(t, 42.0, summary.TotalCoverage)
+	})
+
+	t.Run("invalid json body", func(t *testing.T) {
+		r, err := newNotifyReporter([]NotifyConf{{Name: "chat", URL: "http://localhost", Body: `{"text": {{.Module}}}`}}, summaryInfo{module: "mod"}, PublishConf{})
+		assert.NoError(t, err)
+		assert.ErrorContains(t, r.OnSummary(result), "notify chat: body is not valid JSON")
+	})
+
+	t.Run("failing hook does not stop the others", func(t *testing.T) {
+		server, requests := stub()
+		defer server.Close()
+
+		r, err := newNotifyReporter([]NotifyConf{
+			{Name: "slack", URL: server.URL + "/slack", Body: `{"text": {{.Module}}}`},
+			{Name: "teams", URL: server.URL + "/teams"},
+			{Name: "chat", URL: server.URL + "/chat", Body: `{"text": {{.Version}}}`},
+		}, summaryInfo{module: "mod", version: "v1"}, PublishConf{})
+		assert.NoError(t, err)
+
+		err = r.OnSummary(result)
+		assert.ErrorContains(t, err, "notify slack: body is not valid JSON")
+		assert.ErrorContains(t, err, "notify chat: body is not valid JSON")
+		assert.Len(t, *requests, 1)
+		assert.Equal(t, "/teams", (*requests)[0].Path)
+	})
+
+	t.Run("hook settings override publish", func(t *testing.T) {
+		server, requests := stub(http.StatusBadGateway, http.StatusBadGateway, http.StatusOK)
+		defer server.Close()
+
+		err := NotifyConf{Name: "chat", URL: server.URL, Attempts: 2}.send([]byte("{}"), PublishConf{Attempts: 5})
+		assert.ErrorContains(t, err, "notify chat: POST "+server.URL+": 502 Bad Gateway: nope")
+		assert.Len(t, *requests, 2)
+	})
+
+	t.Run("secret url not shown", func(t *testing.T) {
+		server, _ := stub(http.StatusNotFound)
+		defer server.Close()
+		t.Setenv("NOTIFY_URL", server.URL)
+
+		err := NotifyConf{URL: "${NOTIFY_URL}"}.send([]byte("{}"), PublishConf{})
+		assert.EqualError(t, err, "notify ${NOTIFY_URL}: POST ${NOTIFY_URL}: 404 Not Found: nope")
+	})
+}
@@ -5,237 +5,234 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"unicode"
-
-	"golang.org/x/exp/maps"
 )
 
-type processOutputParams struct {
-	OutputChannel   <-chan TestEvent
+// terminalReporter prints the tests progress and the run summary to the terminal
+type terminalReporter struct {
 	LineOut         func(str ...string)
 	ToTestPackages  []string
-	IgnoredPackages []string
-	NoTestsPackages []Package
 	FlagVerbose     bool
 	FlagSkipEmpty   bool
 	FlagListEmpty   bool
 	FlagListIgnored bool
+	IgnoredRules    map[string]string // rule that excluded each ignored package, shown with -listignored
+	GitHubGroups    bool              // wrap the tests output of each package in a GitHub Actions '::group::'
 	IndentSpaces    int
-	CoverProfile    string
-	FailedTests     *[]string
-	TotalCoverage   *float64
+
+	maxPkgLen       int
+	failedTests     map[string]bool
+	testOutputLines map[string][]string
+	openGroup       string
 }
 
 var regexNoTests = regexp.MustCompile(`^\?\s+(.+)\s+\[no test files\]$`)
 var regexPackageSummary = regexp.MustCompile(`^(ok  \t|FAIL\t)`)
 var regexCoverageAny = regexp.MustCompile(`^coverage: `)
-var regexCoverageNonZero = regexp.MustCompile(`^coverage: (\d{1,3}\.\d{1,2}%) of statements\n$`)
+var regexCoverageNonZero = regexp.MustCompile(`^coverage: (\d{1,3}\.\d{1,2}%) of statements( in .+)?\n$`) // 'in ...' with -coverpkg
 var regexCoverageNoStatements = regexp.MustCompile(`^coverage: \[no statements\]\n$`)
 var regexRunLine = regexp.MustCompile(`^=== (RUN|CONT|PAUSE)`)
 var regexPassFailLine = regexp.MustCompile(`^(PASS|FAIL)$`)
 var regexTestSummary = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): `)
 var regexTestSkip = regexp.MustCompile(`^\s*--- SKIP: `)
+var regexPanic = regexp.MustCompile(`^panic: `)
+
+func (t *terminalReporter) init() {
+	if t.failedTests != nil {
+		return
+	}
 
-func processOutput(params *processOutputParams) {
-	pkgsNoTests := []string{}
-	pkgsFailed := []string{}
-	failedTests := map[string]bool{}
-	coverages := []float64{}
-	testOutputLines := map[string][]string{}
-	prevCoverages := map[string]string{}
+	t.failedTests = map[string]bool{}
+	t.testOutputLines = map[string][]string{}
 
-	maxPkgLen := 0
-	for _, pkg := range params.ToTestPackages {
+	for _, pkg := range t.ToTestPackages {
 		pkglen := len(pkg)
-		maxPkgLen = ifelse(maxPkgLen < pkglen, pkglen, maxPkgLen)
+		t.maxPkgLen = ifelse(t.maxPkgLen < pkglen, pkglen, t.maxPkgLen)
 	}
+}
 
-	noTestsPkgsMap := map[string]bool{}
-	for _, p := range params.NoTestsPackages {
-		noTestsPkgsMap[p.ImportPath] = true
+func (t *terminalReporter) lineOutTrimmed(s string) {
+	lines := strings.Split(s, "\n")
+	for _, l := range lines {
+		trimmed := strings.TrimRightFunc(l, unicode.IsSpace)
+		if trimmed != "" {
+			t.LineOut(trimmed)
+		}
 	}
+}
 
-	lineOutTrimmed := func(s string) {
-		lines := strings.Split(s, "\n")
-		for _, l := range lines {
-			trimmed := strings.TrimRightFunc(l, unicode.IsSpace)
-			if trimmed != "" {
-				params.LineOut(trimmed)
-			}
-		}
+// testLineOut prints test output lines, grouped by package if enabled
+func (t *terminalReporter) testLineOut(pkg, s string) {
+	if t.GitHubGroups && t.openGroup != pkg {
+		t.closeGroup()
+		t.LineOut("::group::" + pkg)
+		t.openGroup = pkg
 	}
+	t.lineOutTrimmed(s)
+}
 
-	printNoTestPkg := func(pkg string) {
-		pkgsNoTests = append(pkgsNoTests, pkg)
+func (t *terminalReporter) closeGroup() {
+	if t.openGroup != "" {
+		t.LineOut("::endgroup::")
+		t.openGroup = ""
+	}
+}
 
-		if !params.FlagSkipEmpty {
-			coverages = append(coverages, 0)
+func (t *terminalReporter) OnPackageStart(pkg string) {}
 
-			outLine := shColor("yellow:bold", "!") + " " + pkg
-			outLine += strings.Repeat(" ", maxPkgLen-len(pkg)) + "   " + shColor("gray", sf("%6s", "0.0%"))
-			outLine += "     " + shColor("yellow", "no tests")
-			lineOutTrimmed(outLine)
-		}
+// OnTestEvent prints the test lines: all if verbose, else only of failed tests
+func (t *terminalReporter) OnTestEvent(event TestEvent) {
+	t.init()
+
+	if event.Action != "output" {
+		return
 	}
 
-	// Parse each line output
-	for event := range params.OutputChannel {
+	if regexPackageSummary.MatchString(event.Output) ||
+		regexPassFailLine.MatchString(event.Output) ||
+		regexRunLine.MatchString(event.Output) ||
+		regexNoTests.MatchString(event.Output) ||
+		regexCoverageAny.MatchString(event.Output) {
+		return
+	}
 
-		if event.Action == "output" {
-			if regexPackageSummary.MatchString(event.Output) ||
-				regexPassFailLine.MatchString(event.Output) ||
-				regexRunLine.MatchString(event.Output) ||
-				regexNoTests.MatchString(event.Output) {
-				continue
-			}
+	testOutLine := event.Output
+	testOutLine = strings.TrimRightFunc(testOutLine, unicode.IsSpace)
+	testOutLine = strings.ReplaceAll(testOutLine, "    ", strings.Repeat(" ", t.IndentSpaces))
 
-			// Save coverage for later
-			if regexCoverageAny.MatchString(event.Output) {
-				prevCoverages[event.Package] = event.Output
-				continue
-			}
+	if regexTestSummary.MatchString(testOutLine) {
+		isFail := strings.Contains(testOutLine, "--- FAIL")
 
-			testOutLine := event.Output
-			testOutLine = strings.TrimRightFunc(testOutLine, unicode.IsSpace)
-			testOutLine = strings.ReplaceAll(testOutLine, "    ", strings.Repeat(" ", params.IndentSpaces))
-
-			if regexTestSummary.MatchString(testOutLine) {
-				isFail := strings.Contains(testOutLine, "--- FAIL")
-
-				if isFail && event.Test != "" && !mapHasKey(failedTests, event.Test) {
-					failedTests[event.Test] = true
-				}
-
-				testOutLine = strings.Replace(testOutLine, "(0.00s)", "", 1)
-				testOutLine = strings.Replace(testOutLine, "--- PASS: ", shColor("whitesmoke", "✔ "), 1)
-				testOutLine = strings.Replace(testOutLine, "--- FAIL: ", shColor("red", "✖ "), 1)
-
-				if regexTestSkip.MatchString(testOutLine) {
-					testOutLine = strings.Replace(testOutLine, "--- SKIP: ", shColor("gray", "≋ "), 1) + "    " + shColor("gray", "skipped")
-				}
-
-				// Print non-package lines if verbose or the test failed
-				if params.FlagVerbose || mapHasKey(failedTests, event.Test) {
-					lineOutTrimmed(testOutLine)
-					for _, l := range testOutputLines[event.Test] {
-						lineOutTrimmed(l)
-					}
-					// clear already printed lines
-					testOutputLines[event.Test] = []string{}
-				}
-
-			} else if testOutLine != "" {
-				testOutLine = strings.ReplaceAll(testOutLine, "\t", strings.Repeat(" ", params.IndentSpaces))
-				testOutLine = shColor("whitesmoke", testOutLine)
-
-				if event.Test != "" {
-					// if TestSummary already printed this can be printed too
-					if mapHasKey(failedTests, event.Test) {
-						lineOutTrimmed(testOutLine)
-
-					} else { // save to print later
-						testOutputLines[event.Test] = append(testOutputLines[event.Test], testOutLine)
-					}
-				}
-			}
+		if isFail && event.Test != "" && !mapHasKey(t.failedTests, event.Test) {
+			t.failedTests[event.Test] = true
 		}
 
-		// Print no test packages
-		if event.Test == "" && (event.Action == "skip" || (event.Action == "pass" && noTestsPkgsMap[event.Package])) {
-			printNoTestPkg(event.Package)
-			continue
-		}
+		testOutLine = strings.Replace(testOutLine, "(0.00s)", "", 1)
+		testOutLine = strings.Replace(testOutLine, "--- PASS: ", shColor("whitesmoke", "✔ "), 1)
+		testOutLine = strings.Replace(testOutLine, "--- FAIL: ", shColor("red", "✖ "), 1)
 
-		// Print Package PASS / FAIL lines
-		var outLine string
-		if event.Test == "" && (event.Action == "pass" || event.Action == "fail") {
+		if regexTestSkip.MatchString(testOutLine) {
+			testOutLine = strings.Replace(testOutLine, "--- SKIP: ", shColor("gray", "≋ "), 1) + "    " + shColor("gray", "skipped")
+		}
 
-			if event.Action == "pass" {
-				outLine = shColor("green", "✔ ") + shColor("reset:bold", event.Package)
+		// Print non-package lines if verbose or the test failed
+		if t.FlagVerbose || mapHasKey(t.failedTests, event.Test) {
+			t.testLineOut(event.Package, testOutLine)
+			for _, l := range t.testOutputLines[event.Test] {
+				t.testLineOut(event.Package, l)
 			}
+			// clear already printed lines
+			t.testOutputLines[event.Test] = []string{}
+		}
+
+	} else if testOutLine != "" {
+		testOutLine = strings.ReplaceAll(testOutLine, "\t", strings.Repeat(" ", t.IndentSpaces))
+		testOutLine = shColor("whitesmoke", testOutLine)
+
+		if event.Test != "" {
+			// if TestSummary already printed this can be printed too
+			if mapHasKey(t.failedTests, event.Test) {
+				t.testLineOut(event.Package, testOutLine)
 
-			if event.Action == "fail" {
-				pkgsFailed = append(pkgsFailed, event.Package)
-				outLine = shColor("red", "◼ ") + shColor("reset:bold", event.Package)
+			} else { // save to print later
+				t.testOutputLines[event.Test] = append(t.testOutputLines[event.Test], testOutLine)
 			}
+		}
+	}
+}
 
-			outLine += strings.Repeat(" ", maxPkgLen-len(event.Package))
+// OnPackageDone prints the package PASS / FAIL / no tests line
+func (t *terminalReporter) OnPackageDone(pkg PackageResult) {
+	t.init()
 
-			// Build package coverage + elapsed
-			prevCoverage := prevCoverages[event.Package]
-			if regexCoverageNoStatements.MatchString(prevCoverage) {
-				outLine += "   " + shColor("gray", sf("%6s", "-")+"     no statements")
+	if pkg.NoTests {
+		if !t.FlagSkipEmpty {
+			outLine := shColor("yellow:bold", "!") + " " + pkg.Name
+			outLine += strings.Repeat(" ", t.maxPkgLen-len(pkg.Name)) + "   " + shColor("gray", sf("%6s", "0.0%"))
+			outLine += "     " + shColor("yellow", "no tests")
+			t.lineOutTrimmed(outLine)
+		}
+		return
+	}
 
-			} else {
-				pkgCoverage := regexCoverageNonZero.ReplaceAllString(prevCoverage, "$1")
-				c := coverageParse(pkgCoverage)
-				coverages = append(coverages, c)
-				outLine += "   " + shColor(coverageColor(c), sf("%6s", pkgCoverage)) + "     "
+	t.closeGroup()
 
-				if event.Elapsed == 0 {
-					outLine += shColor("gray", "cached") // elapsed 0 == cached (we cannot tell otherwise from the JSON)
-				} else {
-					outLine += fmt.Sprintf("%.3fs", event.Elapsed)
-				}
-			}
+	var outLine string
+	if pkg.Status == "pass" {
+		outLine = shColor("green", "✔ ") + shColor("reset:bold", pkg.Name)
+	}
 
-			if params.FlagVerbose {
-				// print a separator between packages
-				outLine += "\n" + shColor("gray", strings.Repeat("-", maxPkgLen+22))
-			}
+	if pkg.Status == "fail" {
+		outLine = shColor("red", "◼ ") + shColor("reset:bold", pkg.Name)
+	}
+
+	outLine += strings.Repeat(" ", t.maxPkgLen-len(pkg.Name))
+
+	// Build package coverage + elapsed
+	if pkg.NoStatements {
+		outLine += "   " + shColor("gray", sf("%6s", "-")+"     no statements")
+
+	} else {
+		c := coverageParse(pkg.Coverage)
+		outLine += "   " + shColor(coverageColor(c), sf("%6s", pkg.Coverage)) + "     "
+
+		if pkg.Elapsed == 0 {
+			outLine += shColor("gray", "cached") // elapsed 0 == cached (we cannot tell otherwise from the JSON)
+		} else {
+			outLine += fmt.Sprintf("%.3fs", pkg.Elapsed)
 		}
+	}
 
-		lineOutTrimmed(outLine)
+	if t.FlagVerbose {
+		// print a separator between packages
+		outLine += "\n" + shColor("gray", strings.Repeat("-", t.maxPkgLen+22))
 	}
 
-	params.LineOut()
+	t.lineOutTrimmed(outLine)
+}
+
+// OnSummary prints the packages and coverage summary
+func (t *terminalReporter) OnSummary(result RunResult) error {
+	t.LineOut()
 
 	// Print summary
 	chev := shColor("gray", "❯")
-	pkgs := sf("tested: %d", len(params.ToTestPackages))
-	pkgs += shColor("red", sf("    failed: %d", len(pkgsFailed)))
-	pkgs += shColor("yellow", sf("    noTests: %d", len(pkgsNoTests)))
-	pkgs += shColor("gray", sf("    excluded: %d", len(params.IgnoredPackages)))
-	params.LineOut(sf("%s Pkgs: %s", chev, pkgs))
+	pkgs := sf("tested: %d", result.TestedPackages)
+	pkgs += shColor("red", sf("    failed: %d", len(result.FailedPackages)))
+	pkgs += shColor("yellow", sf("    noTests: %d", len(result.NoTestsPackages)))
+	pkgs += shColor("gray", sf("    excluded: %d", len(result.IgnoredPackages)))
+	t.LineOut(sf("%s Pkgs: %s", chev, pkgs))
 
 	// Print coverage
-	totalCoverage, isAvg := getTotalCoverage(params.CoverProfile, coverages)
-	covFormatted := sf("%.2f", totalCoverage) + "%"
-	covColor := coverageColor(totalCoverage) + ":bold"
-
-	note := ifelse(isAvg, "   [average]    "+shColor("gray", "(set flag 'fullCoverage' for accurate calculation)"), "   [accurate]")
-	params.LineOut(sf("%s Coverage: %s%s", chev, shColor(covColor, covFormatted), note))
-
-	if params.FlagListEmpty {
-		params.LineOut()
-		params.LineOut(shColor("yellow:bold", "Packages with no tests:"))
-		for _, pkg := range pkgsNoTests {
-			params.LineOut("- " + pkg)
-		}
-	}
+	covFormatted := sf("%.2f", result.TotalCoverage) + "%"
+	covColor := coverageColor(result.TotalCoverage) + ":bold"
+
+	note := ifelse(!result.CoverageAccurate, "   [average]    "+shColor("gray", "(set flag 'fullCoverage' for accurate calculation)"), "   [accurate]")
+	t.LineOut(sf("%s Coverage: %s%s", chev, shColor(covColor, covFormatted), note))
 
-	if params.FlagListIgnored {
-		params.LineOut()
-		params.LineOut(shColor("yellow:bold", "Packages ignored:"))
-		for _, pkg := range params.IgnoredPackages {
-			params.LineOut("- " + pkg)
+	if t.FlagListEmpty {
+		t.LineOut()
+		t.LineOut(shColor("yellow:bold", "Packages with no tests:"))
+		for _, pkg := range result.NoTestsPackages {
+			t.LineOut("- " + pkg)
 		}
 	}
 
-	// "return" total coverage to caller
-	if params.TotalCoverage != nil {
-		*params.TotalCoverage = totalCoverage
+	if t.FlagListIgnored {
+		t.LineOut()
+		t.LineOut(shColor("yellow:bold", "Packages ignored:"))
+		for _, pkg := range result.IgnoredPackages {
+			if rule, ok := t.IgnoredRules[pkg]; ok {
+				t.LineOut("- "+pkg, shColor("gray", "("+rule+")"))
+				continue
+			}
+			t.LineOut("- " + pkg)
+		}
 	}
 
-	// "return" failed tests to caller
-	if params.FailedTests != nil {
-		failedTestsList := maps.Keys(failedTests)
-		sort.Strings(failedTestsList)
-		*params.FailedTests = failedTestsList
-	}
+	return nil
 }
 
 func coverageParse(cov string) float64 {
@@ -274,11 +271,15 @@ func getTotalCoverage(coverProfile string, coverages []float64) (float64, bool)
 		if len(parts) == 3 && parts[2] != "" {
 			lineStat, _ := strconv.ParseFloat(parts[1], 64)
 			stat += lineStat
-			if parts[2] == "1" {
+			if count, _ := strconv.Atoi(parts[2]); count > 0 { // 'count' and 'atomic' modes count the runs
 				cov += lineStat
 			}
 		}
 	}
 
+	if stat == 0 {
+		return 0, false
+	}
+
 	return (cov / stat) * 100, false
 }
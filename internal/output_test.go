@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -9,7 +11,18 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func runTests(p *processOutputParams, outLines ...TestEvent) []string {
+// outputTest holds the options of a processOutput + terminalReporter test run
+type outputTest struct {
+	ToTestPackages  []string
+	IgnoredPackages []string
+	FlagVerbose     bool
+	FlagSkipEmpty   bool
+	FlagListEmpty   bool
+	FlagListIgnored bool
+	GitHubGroups    bool
+}
+
+func runTests(p *outputTest, outLines ...TestEvent) []string {
 	c := make(chan TestEvent)
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -20,17 +33,22 @@ func runTests(p *processOutputParams, outLines ...TestEvent) []string {
 	}
 
 	go func() {
-		processOutput(&processOutputParams{
+		_, _ = processOutput(&processOutputParams{
 			OutputChannel:   c,
-			LineOut:         lineOut,
 			ToTestPackages:  p.ToTestPackages,
 			IgnoredPackages: p.IgnoredPackages,
-			FlagVerbose:     p.FlagVerbose,
 			FlagSkipEmpty:   p.FlagSkipEmpty,
-			FlagListEmpty:   p.FlagListEmpty,
-			FlagListIgnored: p.FlagListIgnored,
-			IndentSpaces:    2,
 			CoverProfile:    "",
+			Reporters: []Reporter{&terminalReporter{
+				LineOut:         lineOut,
+				ToTestPackages:  p.ToTestPackages,
+				FlagVerbose:     p.FlagVerbose,
+				FlagSkipEmpty:   p.FlagSkipEmpty,
+				FlagListEmpty:   p.FlagListEmpty,
+				FlagListIgnored: p.FlagListIgnored,
+				GitHubGroups:    p.GitHubGroups,
+				IndentSpaces:    2,
+			}},
 		})
 		wg.Done()
 	}()
@@ -49,7 +67,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("one dummy test, no coverage flag", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}},
+			&outputTest{ToTestPackages: []string{"tst"}},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestDummy"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestDummy", Output: "=== RUN   TestDummy\n"},
@@ -70,7 +88,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("one dummy test, coverage flag", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}},
+			&outputTest{ToTestPackages: []string{"tst"}},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestDummy"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestDummy", Output: "=== RUN   TestDummy\n"},
@@ -93,7 +111,7 @@ func TestProcessOutput(t *testing.T) {
 	// with the new logic, skipped are written only on verbose
 	t.Run("one skipped", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}, FlagVerbose: true},
+			&outputTest{ToTestPackages: []string{"tst"}, FlagVerbose: true},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestOther"},
 
@@ -120,7 +138,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("failing test", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}},
+			&outputTest{ToTestPackages: []string{"tst"}},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestFailing"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestFailing", Output: "=== RUN   TestFailing\n"},
@@ -147,9 +165,35 @@ func TestProcessOutput(t *testing.T) {
 		}, out)
 	})
 
+	t.Run("failing test, github groups", func(t *testing.T) {
+		out := runTests(
+			&outputTest{ToTestPackages: []string{"tst"}, GitHubGroups: true},
+
+			TestEvent{Action: "run", Package: "tst", Test: "TestFailing"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestFailing", Output: "=== RUN   TestFailing\n"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestFailing", Output: "    code_test.go:12: but a test ain't one\n"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestFailing", Output: "--- FAIL: TestFailing (0.00s)\n"},
+			TestEvent{Action: "fail", Package: "tst", Test: "TestFailing", Elapsed: 0},
+			TestEvent{Action: "output", Package: "tst", Output: "FAIL\n"},
+			TestEvent{Action: "output", Package: "tst", Output: "FAIL\ttst\t0.308s\n"},
+			TestEvent{Action: "fail", Package: "tst", Elapsed: 0.308},
+		)
+
+		assert.Equal(t, []string{
+			"::group::tst",
+			"✖ TestFailing",
+			"  code_test.go:12: but a test ain't one",
+			"::endgroup::",
+			"◼ tst              0.308s",
+			"",
+			"❯ Pkgs: tested: 1    failed: 1    noTests: 0    excluded: 0",
+			"❯ Coverage: 0.00%   [average]    (set flag 'fullCoverage' for accurate calculation)",
+		}, out)
+	})
+
 	t.Run("no tests line (no skip)", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}},
+			&outputTest{ToTestPackages: []string{"tst"}},
 
 			TestEvent{Action: "output", Package: "tst", Output: "?   \ttst\t[no test files]\n"},
 			TestEvent{Action: "skip", Package: "tst", Elapsed: 0},
@@ -165,7 +209,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("no tests line (skip)", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}, FlagSkipEmpty: true},
+			&outputTest{ToTestPackages: []string{"tst"}, FlagSkipEmpty: true},
 
 			TestEvent{Action: "output", Package: "tst", Output: "?   \ttst\t[no test files]\n"},
 			TestEvent{Action: "skip", Package: "tst", Elapsed: 0},
@@ -180,7 +224,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("no tests line (list)", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}, FlagListEmpty: true},
+			&outputTest{ToTestPackages: []string{"tst"}, FlagListEmpty: true},
 
 			TestEvent{Action: "output", Package: "tst", Output: "?   \ttst\t[no test files]\n"},
 			TestEvent{Action: "skip", Package: "tst", Elapsed: 0},
@@ -199,7 +243,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("ok line, coverage", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}},
+			&outputTest{ToTestPackages: []string{"tst"}},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestGood"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestGood", Output: "=== RUN   TestGood\n"},
@@ -222,7 +266,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("coverage no statements", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}},
+			&outputTest{ToTestPackages: []string{"tst"}},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestGood"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestGood", Output: "=== RUN   TestGood\n"},
@@ -245,7 +289,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("one test fail, one successful, no verbose, coverage", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}},
+			&outputTest{ToTestPackages: []string{"tst"}},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestFailing"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestFailing", Output: "=== RUN   TestFailing\n"},
@@ -281,7 +325,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("one test fail, one successful, verbose, coverage", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}, FlagVerbose: true},
+			&outputTest{ToTestPackages: []string{"tst"}, FlagVerbose: true},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestFailing"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestFailing", Output: "=== RUN   TestFailing\n"},
@@ -321,7 +365,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("ignored, no list", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}, IgnoredPackages: []string{"tst/ignored"}},
+			&outputTest{ToTestPackages: []string{"tst"}, IgnoredPackages: []string{"tst/ignored"}},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestGood"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestGood", Output: "=== RUN   TestGood\n"},
@@ -344,7 +388,7 @@ func TestProcessOutput(t *testing.T) {
 
 	t.Run("ignored, list", func(t *testing.T) {
 		out := runTests(
-			&processOutputParams{ToTestPackages: []string{"tst"}, IgnoredPackages: []string{"tst/ignored"}, FlagListIgnored: true},
+			&outputTest{ToTestPackages: []string{"tst"}, IgnoredPackages: []string{"tst/ignored"}, FlagListIgnored: true},
 
 			TestEvent{Action: "run", Package: "tst", Test: "TestGood"},
 			TestEvent{Action: "output", Package: "tst", Test: "TestGood", Output: "=== RUN   TestGood\n"},
@@ -369,6 +413,24 @@ func TestProcessOutput(t *testing.T) {
 	})
 }
 
+func TestGetTotalCoverage(t *testing.T) {
+	t.Parallel()
+
+	for mode, counts := range map[string][2]string{"set": {"1", "0"}, "atomic": {"7", "0"}, "count": {"2", "0"}} {
+		path := filepath.Join(t.TempDir(), "coverage.out")
+		profile := sf("mode: %s\nmod/a/a.go:1.1,2.2 3 %s\nmod/a/a.go:3.1,4.2 1 %s\n", mode, counts[0], counts[1])
+		assert.NoError(t, os.WriteFile(path, []byte(profile), 0o666))
+
+		total, average := getTotalCoverage(path, nil)
+		assert.Equal(t, 75.0, total, mode)
+		assert.False(t, average, mode)
+	}
+
+	total, average := getTotalCoverage("", []float64{50, 100})
+	assert.Equal(t, 75.0, total)
+	assert.True(t, average)
+}
+
 func TestCoverageParse(t *testing.T) {
 	assert.Equal(t, 12.3, coverageParse("  12.30% "))
 	assert.Equal(t, 3.2, coverageParse("3.20%\n"))
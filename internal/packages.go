@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// PackageConf holds the 'go test' settings of the packages matching a pattern, set in the config 'packages' map.
+// Patterns are the include/exclude ones eg. './internal/db/...' or '**/integration', '!' applies to the packages not matching.
+type PackageConf struct {
+	Timeout  string            `json:"timeout"`  // go test -timeout eg. 10m
+	Tags     []string          `json:"tags"`     // build tags eg. integration
+	Env      map[string]string `json:"env"`      // environment variables of the 'go test' run
+	Args     []string          `json:"args"`     // extra 'go test' args eg. -race or -parallel=1
+	Coverage float64           `json:"coverage"` // minimum coverage percentage, the run fails if a package is below it
+	Cache    *bool             `json:"cache"`    // false to always run the tests, overrides the 'cache' setting
+}
+
+func (pc PackageConf) validate() error {
+	if pc.Timeout != "" {
+		if _, err := time.ParseDuration(pc.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %q", pc.Timeout)
+		}
+	}
+	if pc.Coverage < 0 || pc.Coverage > 100 {
+		return fmt.Errorf("coverage must be between 0 and 100")
+	}
+	return nil
+}
+
+// merge overrides 'pc' with the settings 'o' sets, tags, args and env are added
+func (pc PackageConf) merge(o PackageConf) PackageConf {
+	pc.Timeout = zvfb(o.Timeout, pc.Timeout)
+	if len(o.Tags) > 0 {
+		pc.Tags = append(append([]string{}, pc.Tags...), o.Tags...)
+	}
+	if len(o.Args) > 0 {
+		pc.Args = append(append([]string{}, pc.Args...), o.Args...)
+	}
+	pc.Coverage = zvfb(o.Coverage, pc.Coverage)
+	if o.Cache != nil {
+		pc.Cache = o.Cache
+	}
+	if len(o.Env) > 0 {
+		pc.Env = mapMerge(pc.Env, o.Env)
+	}
+	return pc
+}
+
+// testArgs returns the 'go test' args of the settings, 'cache' is the global setting
+func (pc PackageConf) testArgs(cache bool) shArgs {
+	args := shArgs{}
+	args = sliceAppendIf(pc.Timeout != "", args, "-timeout="+pc.Timeout)
+	args = sliceAppendIf(len(pc.Tags) > 0, args, "-tags="+strings.Join(pc.Tags, ","))
+	if pc.Cache != nil {
+		cache = *pc.Cache
+	}
+	args = sliceAppendIf(!cache, args, "-count=1")
+	return append(args, pc.Args...)
+}
+
+// environ returns the environment of the 'go test' run, nil to inherit it
+func (pc PackageConf) environ() []string {
+	if len(pc.Env) == 0 {
+		return nil
+	}
+	env := os.Environ()
+	for _, k := range mapSortedKeys(pc.Env) {
+		env = append(env, k+"="+pc.Env[k])
+	}
+	return env
+}
+
+// packageGroup are packages with the same settings, tested by one 'go test' run
+type packageGroup struct {
+	conf PackageConf
+	pkgs []string
+}
+
+// specificity ranks the kinds of patterns: negated ones, import path regexes and globs, '/...' dirs and exact dirs
+func (p pkgPattern) specificity() int {
+	switch {
+	case p.negate:
+		return 0
+	case p.regex != nil:
+		return 1
+	case p.subDir:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// sortPkgPatterns sorts the patterns from the least to the most specific: by kind, then the longer patterns last.
+// The config maps have no reliable key order once merged across the config layers, so the specificity decides.
+func sortPkgPatterns(patterns []pkgPattern) {
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if a.specificity() != b.specificity() {
+			return a.specificity() < b.specificity()
+		}
+		if len(a.rule) != len(b.rule) {
+			return len(a.rule) < len(b.rule)
+		}
+		return a.rule < b.rule
+	})
+}
+
+// groupPackages resolves the settings of each package from the 'confs' matching it, the more specific patterns last so they override.
+// Returns the packages grouped by settings (in the order of their first package) and the settings of each package.
+func groupPackages(packages []string, pkgsMap map[string]Package, confs map[string]PackageConf, root string) ([]packageGroup, map[string]PackageConf, error) {
+	patterns, err := parsePkgPatterns(mapSortedKeys(confs), root)
+	if err != nil {
+		return nil, nil, err
+	}
+	sortPkgPatterns(patterns)
+
+	groups := []packageGroup{}
+	groupIdx := map[string]int{}
+	pkgConfs := map[string]PackageConf{}
+
+	for _, pkg := range packages {
+		p := pkgsMap[pkg]
+		p.ImportPath = pkg
+
+		pc := PackageConf{}
+		for _, pattern := range patterns {
+			if pattern.match(p) != pattern.negate {
+				pc = pc.merge(confs[pattern.rule])
+			}
+		}
+		pkgConfs[pkg] = pc
+
+		key, _ := json.Marshal(pc)
+		idx, ok := groupIdx[string(key)]
+		if !ok {
+			idx = len(groups)
+			groupIdx[string(key)] = idx
+			groups = append(groups, packageGroup{conf: pc})
+		}
+		groups[idx].pkgs = append(groups[idx].pkgs, pkg)
+	}
+
+	return groups, pkgConfs, nil
+}
+
+// belowCoverage returns the packages with a coverage below their 'coverage' setting, sorted.
+// The packages without collected coverage (failed builds, -cover=false) are skipped.
+func belowCoverage(result RunResult, pkgConfs map[string]PackageConf) []string {
+	below := []string{}
+	for _, pkg := range result.Packages {
+		threshold := pkgConfs[pkg.Name].Coverage
+		if threshold > 0 && pkg.Coverage != "" && !pkg.FailedBuild && !pkg.NoStatements && coverageParse(pkg.Coverage) < threshold {
+			below = append(below, sf("%s %s < %.1f%%", pkg.Name, pkg.Coverage, threshold))
+		}
+	}
+	sort.Strings(below)
+	return below
+}
+
+// getCoverMode returns the -covermode of the 'go test' runs, they need the same one for their cover profiles to merge.
+// It's the one set by the packages args, else 'atomic' if a run uses -race (its default then), else "" for the go test default.
+func getCoverMode(groups []packageGroup) (string, error) {
+	mode, race := "", false
+	for _, group := range groups {
+		for _, arg := range group.conf.Args {
+			race = race || arg == "-race"
+			if !strings.HasPrefix(arg, "-covermode=") {
+				continue
+			}
+			m := strings.TrimPrefix(arg, "-covermode=")
+			if mode != "" && m != mode {
+				return "", fmt.Errorf("the packages settings use different coverage modes: %s and %s", mode, m)
+			}
+			mode = m
+		}
+	}
+	if mode == "" && race {
+		mode = "atomic"
+	}
+	return mode, nil
+}
+
+// mergeCoverProfiles writes the cover profiles of the 'go test' runs into 'coverProfile', with a single mode line
+func mergeCoverProfiles(coverProfile string, profiles []string) error {
+	out, err := os.Create(coverProfile)
+	if err != nil {
+		return fmt.Errorf("failed to create cover profile: %w", err)
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	mode := ""
+	for _, profile := range profiles {
+		data, err := os.ReadFile(profile)
+		if err != nil {
+			continue // the run failed before writing it eg. build errors
+		}
+
+		for _, line := range splitLines(string(data)) {
+			if strings.HasPrefix(line, "mode:") {
+				if mode != "" && line != mode {
+					return fmt.Errorf("cannot merge cover profiles with different modes: %q and %q", mode, line)
+				}
+				if mode != "" {
+					continue
+				}
+				mode = line
+			}
+			if line != "" {
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+
+	return w.Flush()
+}
+
+// lineWriter writes whole lines to a writer shared by concurrent 'go test' runs so their output does not interleave
+type lineWriter struct {
+	mu  *sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	i := bytes.LastIndexByte(lw.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	lw.mu.Lock()
+	_, err := lw.w.Write(lw.buf[:i+1])
+	lw.mu.Unlock()
+	lw.buf = slices.Clone(lw.buf[i+1:])
+	return len(p), err
+}
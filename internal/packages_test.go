@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupPackages(t *testing.T) {
+	t.Parallel()
+
+	root := filepath.FromSlash("/src/mod")
+	pkgsMap := map[string]Package{
+		"mod/api":      {Dir: filepath.Join(root, "api")},
+		"mod/db":       {Dir: filepath.Join(root, "db")},
+		"mod/db/query": {Dir: filepath.Join(root, "db", "query")},
+		"mod/util":     {Dir: filepath.Join(root, "util")},
+	}
+	packages := []string{"mod/api", "mod/db", "mod/db/query", "mod/util"}
+	noCache := false
+
+	confs := map[string]PackageConf{
+		"./db/...":   {Timeout: "10m", Tags: []string{"integration"}, Env: map[string]string{"DB": "test"}, Cache: &noCache},
+		"mod/db/q":   {Args: []string{"-parallel=1"}, Env: map[string]string{"DB": "regex"}},
+		"./db/query": {Env: map[string]string{"DB": "query"}},
+		"!mod/db":    {Coverage: 80},
+		"mod/api$":   {Coverage: 60},
+		"**/nomatch": {Args: []string{"-race"}},
+	}
+
+	groups, pkgConfs, err := groupPackages(packages, pkgsMap, confs, root)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []packageGroup{
+		{conf: PackageConf{Coverage: 60}, pkgs: []string{"mod/api"}},
+		{conf: PackageConf{Timeout: "10m", Tags: []string{"integration"}, Env: map[string]string{"DB": "test"}, Cache: &noCache}, pkgs: []string{"mod/db"}},
+		{conf: PackageConf{Timeout: "10m", Tags: []string{"integration"}, Args: []string{"-parallel=1"}, Env: map[string]string{"DB": "query"}, Cache: &noCache}, pkgs: []string{"mod/db/query"}},
+		{conf: PackageConf{Coverage: 80}, pkgs: []string{"mod/util"}},
+	}, groups)
+	assert.Equal(t, 60.0, pkgConfs["mod/api"].Coverage)
+	assert.Len(t, pkgConfs, 4)
+
+	groups, _, err = groupPackages(packages, pkgsMap, nil, root)
+	assert.NoError(t, err)
+	assert.Equal(t, []packageGroup{{conf: PackageConf{}, pkgs: packages}}, groups)
+
+	_, _, err = groupPackages(packages, pkgsMap, map[string]PackageConf{"mod/(db": {}}, root)
+	assert.ErrorContains(t, err, `cannot compile regex "mod/(db"`)
+}
+
+func TestSortPkgPatterns(t *testing.T) {
+	t.Parallel()
+
+	rules := []string{"./db", "./db/...", "./...", "mod/db/query", "mod/", "**/db", "!mod/api", "!./db/..."}
+	patterns, err := parsePkgPatterns(rules, "/src/mod")
+	assert.NoError(t, err)
+	sortPkgPatterns(patterns)
+
+	sorted := []string{}
+	for _, p := range patterns {
+		sorted = append(sorted, p.rule)
+	}
+	assert.Equal(t, []string{"!mod/api", "!./db/...", "mod/", "**/db", "mod/db/query", "./...", "./db/...", "./db"}, sorted, "least to most specific")
+}
+
+func TestPackageConfTestArgs(t *testing.T) {
+	t.Parallel()
+
+	noCache, cache := false, true
+
+	assert.Equal(t, shArgs{}, PackageConf{}.testArgs(true))
+	assert.Equal(t, shArgs{"-count=1"}, PackageConf{}.testArgs(false))
+	assert.Equal(t, shArgs{}, PackageConf{Cache: &cache}.testArgs(false))
+	assert.Equal(t,
+		shArgs{"-timeout=5m", "-tags=integration,db", "-count=1", "-race"},
+		PackageConf{Timeout: "5m", Tags: []string{"integration", "db"}, Cache: &noCache, Args: []string{"-race"}}.testArgs(true),
+	)
+
+	assert.Nil(t, PackageConf{}.environ())
+	assert.Contains(t, PackageConf{Env: map[string]string{"DB": "test"}}.environ(), "DB=test")
+}
+
+func TestPackageConfValidate(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, PackageConf{Timeout: "1m30s", Coverage: 100}.validate())
+	assert.EqualError(t, PackageConf{Timeout: "10"}.validate(), `invalid timeout "10"`)
+	assert.EqualError(t, PackageConf{Coverage: 120}.validate(), "coverage must be between 0 and 100")
+}
+
+func TestBelowCoverage(t *testing.T) {
+	t.Parallel()
+
+	result := RunResult{Packages: []PackageResult{
+		{Name: "mod/b", Coverage: "40.0%"},
+		{Name: "mod/a", Coverage: "90.0%"},
+		{Name: "mod/c", NoStatements: true},
+		{Name: "mod/d"},
+		{Name: "mod/e", Coverage: "10.0%"},
+		{Name: "mod/f", Coverage: "0.0%"},
+		{Name: "mod/g", FailedBuild: true},
+	}}
+	pkgConfs := map[string]PackageConf{
+		"mod/a": {Coverage: 80},
+		"mod/b": {Coverage: 80},
+		"mod/c": {Coverage: 80},
+		"mod/d": {Coverage: 50}, // no coverage collected
+		"mod/f": {Coverage: 50},
+		"mod/g": {Coverage: 50},
+	}
+
+	assert.Equal(t, []string{"mod/b 40.0% < 80.0%", "mod/f 0.0% < 50.0%"}, belowCoverage(result, pkgConfs))
+	assert.Equal(t, []string{}, belowCoverage(result, nil))
+}
+
+func TestMergeCoverProfiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	one := filepath.Join(dir, "one.out")
+	two := filepath.Join(dir, "two.out")
+	assert.NoError(t, os.WriteFile(one, []byte("mode: set\nmod/a/a.go:1.1,2.2 1 1\n"), 0o666))
+	assert.NoError(t, os.WriteFile(two, []byte("mode: set\nmod/b/b.go:3.1,4.2 2 0\n"), 0o666))
+
+	merged := filepath.Join(dir, "merged.out")
+	assert.NoError(t, mergeCoverProfiles(merged, []string{one, filepath.Join(dir, "missing.out"), two}))
+
+	data, err := os.ReadFile(merged)
+	assert.NoError(t, err)
+	assert.Equal(t, "mode: set\nmod/a/a.go:1.1,2.2 1 1\nmod/b/b.go:3.1,4.2 2 0\n", string(data))
+
+	assert.NoError(t, os.WriteFile(two, []byte("mode: atomic\nmod/b/b.go:3.1,4.2 2 5\n"), 0o666))
+	assert.EqualError(t, mergeCoverProfiles(merged, []string{one, two}), `cannot merge cover profiles with different modes: "mode: set" and "mode: atomic"`)
+}
+
+func TestGetCoverMode(t *testing.T) {
+	t.Parallel()
+
+	group := func(args ...string) packageGroup { return packageGroup{conf: PackageConf{Args: args}} }
+
+	for _, tc := range []struct {
+		groups []packageGroup
+		mode   string
+		err    string
+	}{
+		{groups: []packageGroup{group(), group("-parallel=1")}, mode: ""},
+		{groups: []packageGroup{group(), group("-race")}, mode: "atomic"},
+		{groups: []packageGroup{group("-covermode=count"), group("-covermode=count")}, mode: "count"},
+		{groups: []packageGroup{group("-covermode=set"), group("-covermode=atomic")}, err: "the packages settings use different coverage modes: set and atomic"},
+	} {
+		mode, err := getCoverMode(tc.groups)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.mode, mode)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	var mu sync.Mutex
+	a := &lineWriter{mu: &mu, w: &out}
+	b := &lineWriter{mu: &mu, w: &out}
+
+	_, _ = a.Write([]byte(`{"Action":`))
+	_, _ = b.Write([]byte("{\"Action\":\"run\"}\n{\"Act"))
+	_, _ = a.Write([]byte("\"pass\"}\n"))
+	_, _ = b.Write([]byte("ion\":\"fail\"}\n"))
+
+	assert.Equal(t, "{\"Action\":\"run\"}\n{\"Action\":\"pass\"}\n{\"Action\":\"fail\"}\n", out.String())
+}
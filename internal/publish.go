@@ -0,0 +1,386 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	publishDefaultTimeout  = 10 * time.Second
+	publishDefaultAttempts = 3
+	publishMaxRetryAfter   = 30 * time.Second
+)
+
+// publishBackoff is the wait before the first retry, doubled on each retry
+var publishBackoff = time.Second
+
+// PublishConf holds the code review provider and HTTP settings of the pull request comments and webhooks, set in the config 'publish' section
+type PublishConf struct {
+	Provider string `json:"provider"` // azure, bitbucket, gitea, github or gitlab. detected from the CI variables if empty
+	Timeout  string `json:"timeout"`  // per attempt eg. "5s", defaults to 10s
+	Attempts int    `json:"attempts"` // attempts on network errors, 5xx and 429, defaults to 3
+	DryRun   bool   `json:"-"`        // print the requests instead of sending them
+	Required bool   `json:"-"`        // fail if the pull request details are missing, else skip publishing eg. on local runs
+}
+
+func (pc PublishConf) validate() error {
+	if pc.Timeout == "" {
+		return nil
+	}
+
+	_, err := time.ParseDuration(pc.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid publish timeout: %w", err)
+	}
+	return nil
+}
+
+// apiClient sends the REST API requests of a pull request comment or webhook
+type apiClient struct {
+	name     string            // errors prefix eg. 'github comment'
+	headers  map[string]string // eg. authorization
+	conf     PublishConf
+	urlLabel string    // shown instead of the url in errors and dry-runs eg. if it contains secrets
+	out      io.Writer // dry-run output, defaults to stdout
+}
+
+// request sends 'body' as JSON (or as is if []byte) and decodes the response into 'out'.
+// Network errors, 5xx and 429 responses are retried with backoff.
+func (p apiClient) request(method, reqURL string, body, out any) error {
+	var data []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		data = b
+	default:
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.conf.DryRun {
+		p.printRequest(method, reqURL, data)
+		return nil
+	}
+
+	timeout := publishDefaultTimeout
+	if p.conf.Timeout != "" {
+		timeout, _ = time.ParseDuration(p.conf.Timeout)
+	}
+	client := &http.Client{Timeout: timeout}
+	attempts := zvfb(p.conf.Attempts, publishDefaultAttempts)
+
+	var err error
+	var wait time.Duration
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			backoff := publishBackoff * time.Duration(1<<(attempt-2))
+			time.Sleep(ifelse(wait > backoff, wait, backoff))
+		}
+
+		var retry bool
+		retry, wait, err = p.attempt(client, method, reqURL, data, out)
+		if err == nil || !retry {
+			break
+		}
+	}
+
+	return err
+}
+
+// attempt sends the request once. Returns if a failure may succeed on retry, and the server requested wait.
+func (p apiClient) attempt(client *http.Client, method, reqURL string, data []byte, out any) (bool, time.Duration, error) {
+	var reqBody io.Reader
+	if data != nil {
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, reqURL, reqBody)
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, val := range p.headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, 0, fmt.Errorf("%s: %s %s: %w", p.name, method, p.label(reqURL), unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("%s: %s %s: %s", p.name, method, p.label(reqURL), resp.Status)
+		if msg := strings.TrimSpace(string(respBody)); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, retryAfter(resp.Header.Get("Retry-After")), err
+	}
+
+	if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			return false, 0, fmt.Errorf("%s: failed to read response: %w", p.name, err)
+		}
+	}
+
+	return false, 0, nil
+}
+
+func (p apiClient) label(reqURL string) string {
+	return zvfb(p.urlLabel, reqURL)
+}
+
+var regexSecretHeader = regexp.MustCompile(`(?i)auth|token|key|secret|cookie`)
+
+// printRequest prints the request that would be sent, hiding the credential headers values
+func (p apiClient) printRequest(method, reqURL string, data []byte) {
+	out := p.out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	fmt.Fprintf(out, "[dry-run] %s: %s %s\n", p.name, method, p.label(reqURL))
+	for _, key := range mapSortedKeys(p.headers) {
+		fmt.Fprintf(out, "%s: %s\n", key, ifelse(regexSecretHeader.MatchString(key), "***", p.headers[key]))
+	}
+	if data != nil {
+		fmt.Fprintf(out, "%s\n", data)
+	}
+}
+
+// retryAfter parses a Retry-After header in seconds
+func retryAfter(header string) time.Duration {
+	secs, err := strconv.Atoi(header)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	wait := time.Duration(secs) * time.Second
+	return ifelse(wait > publishMaxRetryAfter, publishMaxRetryAfter, wait)
+}
+
+// unwrapURLError drops the method and url that *url.Error repeats, as the errors already show them (or hide the url)
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// listPages lists the items of all the pages of a REST API list endpoint, sending the requests with 'request'.
+// 'pageURL' is the next page strategy, the url of the page 'page' (from 1) of 'perPage' items.
+func listPages[T any](request func(method, url string, body, out any) error, pageURL func(page, perPage int) string) ([]T, error) {
+	const perPage = 100
+	items := []T{}
+
+	for page := 1; ; page++ {
+		var pageItems []T
+		err := request(http.MethodGet, pageURL(page, perPage), nil, &pageItems)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, pageItems...)
+		if len(pageItems) < perPage {
+			return items, nil
+		}
+	}
+}
+
+// pageNumberURL is the page strategy of the APIs paging with 'page' and 'per_page' query params eg. GitHub and GitLab
+func pageNumberURL(listURL string) func(page, perPage int) string {
+	return func(page, perPage int) string {
+		return sf("%s?per_page=%d&page=%d", listURL, perPage, page)
+	}
+}
+
+// publishProviders are the code review providers of the config 'publish.provider'
+var publishProviders = []string{"azure", "bitbucket", "gitea", "github", "gitlab"}
+
+// Publisher publishes the run results to a code review provider (Azure DevOps, Bitbucket, Gitea, GitHub or GitLab).
+// The providers read their token only from the environment (bar the deprecated -azureDevopsAuthToken) so it does not end up in config files or logs.
+// The publishReporter checks Ready before calling the Publish methods, they expect the pull request details to be set.
+type Publisher interface {
+	// Features returns the enabled publishing features
+	Features() PublishFeatures
+	// Ready checks the pull request details and token are set, from the CI variables or the config.
+	// They are missing outside pull request pipelines.
+	Ready() error
+	// PublishComment publishes the summary 'body' as a pull request comment, updating the one of a previous run
+	PublishComment(body string, failed bool) error
+	// PublishAnnotations publishes a comment at each failure line, resolving (or removing) the ones of a previous run
+	PublishAnnotations(annotations []Annotation) error
+	// PublishStatus sets the commit status check of the run
+	PublishStatus(failed bool, description string) error
+}
+
+// PublishFeatures are the publishing features of a provider, set in its config section eg. 'azure'
+type PublishFeatures struct {
+	Comment        bool `json:"comment"`        // publish the summary as a pull request comment, updated on each run
+	InlineComments bool `json:"inlineComments"` // publish a comment at the file line of each test failure
+	Status         bool `json:"status"`         // set a commit status check
+}
+
+// Annotation is a test failure comment at a file line
+type Annotation struct {
+	File string // absolute path
+	Line int
+	Body string // markdown
+}
+
+// failureAnnotations returns an annotation per failure location, the failures at the same line are combined
+func failureAnnotations(result RunResult, pkgsMap map[string]Package) []Annotation {
+	bodies := map[string]string{}
+	keys := []string{}
+
+	for _, test := range result.Tests {
+		if test.Status != "fail" {
+			continue
+		}
+
+		for _, loc := range failureLocations(test.Output) {
+			file := loc.File
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(pkgsMap[test.Package].Dir, file)
+			}
+
+			key := sf("%s:%d", file, loc.Line)
+			if !mapHasKey(bodies, key) {
+				bodies[key] = "❌ **Test failed**"
+				keys = append(keys, key)
+			}
+			bodies[key] += sf("\n\n`%s` %s\n```\n%s\n```", test.Package, test.Name, zvfb(loc.Message, "test failed"))
+		}
+	}
+
+	annotations := []Annotation{}
+	for _, key := range keys {
+		sep := strings.LastIndex(key, ":")
+		line, _ := strconv.Atoi(key[sep+1:])
+		annotations = append(annotations, Annotation{File: key[:sep], Line: line, Body: bodies[key]})
+	}
+
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].File < annotations[j].File || (annotations[i].File == annotations[j].File && annotations[i].Line < annotations[j].Line)
+	})
+
+	return annotations
+}
+
+// statusDescription summarizes the run for a commit status check
+func statusDescription(result RunResult) string {
+	if len(result.BelowCoverage) > 0 && len(result.FailedTests) == 0 && len(result.FailedPackages) == 0 {
+		return sf("%d packages below their coverage threshold · coverage %.2f%%", len(result.BelowCoverage), result.TotalCoverage)
+	}
+	if result.failed() {
+		return sf("%d tests failed, %d packages failed · coverage %.2f%%", len(result.FailedTests), len(result.FailedPackages), result.TotalCoverage)
+	}
+	return sf("Tests passed · coverage %.2f%%", result.TotalCoverage)
+}
+
+// publishReporter publishes the run results with the selected code review provider.
+// Without the pull request details (eg. local runs of a config enabling the comments) publishing is skipped, unless 'required'.
+type publishReporter struct {
+	nopReporter
+	publisher Publisher
+	required  bool
+	comment   commentTemplate
+	pkgsMap   map[string]Package
+	lineOut   func(str ...string)
+}
+
+func (r publishReporter) OnSummary(result RunResult) error {
+	features := r.publisher.Features()
+	failed := result.failed()
+
+	if !features.Comment && !features.InlineComments && !features.Status {
+		if r.required {
+			return errors.New("publishing was requested but the provider has no comment, inlineComments or status enabled")
+		}
+		return nil
+	}
+	if err := r.publisher.Ready(); err != nil {
+		if r.required {
+			return err
+		}
+		r.lineOut(shColor("gray", sf("Skipped publishing to the pull request: %s", err)))
+		return nil
+	}
+
+	// the comment and status go first, the inline comments may fail on lines outside the diff
+	errs := []error{}
+	if features.Comment {
+		body, err := r.comment.render(result)
+		if err == nil {
+			err = r.publisher.PublishComment(body, failed)
+		}
+		errs = append(errs, err)
+	}
+
+	if features.Status {
+		errs = append(errs, r.publisher.PublishStatus(failed, statusDescription(result)))
+	}
+
+	if features.InlineComments {
+		err := r.publisher.PublishAnnotations(failureAnnotations(result, r.pkgsMap))
+		if err != nil {
+			r.lineOut(shColor("yellow", sf("WARN: failed to publish inline comments: %s", err)))
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// selectPublisher returns the provider set in the config 'publish.provider', else the one detected from the CI variables.
+// Azure DevOps is the default outside the detected CIs, as before the provider could be selected.
+func selectPublisher(opts RunTestsOpts) (Publisher, error) {
+	switch opts.Publish.Provider {
+	case "azure":
+		return opts.Azure, nil
+	case "bitbucket":
+		return opts.Bitbucket, nil
+	case "gitea":
+		return opts.Gitea, nil
+	case "github":
+		return opts.GitHub, nil
+	case "gitlab":
+		return opts.GitLab, nil
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown publish provider '%s' (%s)", opts.Publish.Provider, strings.Join(publishProviders, ", "))
+	}
+
+	switch {
+	case opts.Gitea.Actions: // before GitHub, Gitea Actions sets the GITHUB_* variables too
+		return opts.Gitea, nil
+	case opts.GitHub.Actions:
+		return opts.GitHub, nil
+	case opts.GitLab.CI:
+		return opts.GitLab, nil
+	case opts.Bitbucket.Pipelines:
+		return opts.Bitbucket, nil
+	}
+	return opts.Azure, nil
+}
@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fastBackoff shortens the retries backoff for the test 't'
+func fastBackoff(t *testing.T) {
+	backoff := publishBackoff
+	publishBackoff = time.Millisecond
+	t.Cleanup(func() { publishBackoff = backoff })
+}
+
+func TestAPIClientRequest(t *testing.T) {
+	fastBackoff(t)
+
+	type request struct {
+		Method, Auth, ContentType, Body string
+	}
+
+	stub := func(statuses ...int) (*httptest.Server, *[]request) {
+		requests := []request{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests = append(requests, request{r.Method, r.Header.Get("Authorization"), r.Header.Get("Content-Type"), string(body)})
+			status := sliceAt(statuses, len(requests)-1, http.StatusOK)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(ifelse(status == http.StatusOK, `{"id": 7}`, `{"message": "nope"}`)))
+		}))
+		return server, &requests
+	}
+
+	p := apiClient{name: "test comment", headers: map[string]string{"Authorization": "Bearer tkn", "Accept": "application/json"}}
+
+	t.Run("sends json and decodes response", func(t *testing.T) {
+		server, requests := stub()
+		defer server.Close()
+
+		var out struct{ ID int }
+		assert.NoError(t, p.request(http.MethodPost, server.URL, map[string]string{"body": "hi"}, &out))
+		assert.Equal(t, 7, out.ID)
+		assert.Equal(t, []request{{http.MethodPost, "Bearer tkn", "application/json", `{"body":"hi"}`}}, *requests)
+	})
+
+	t.Run("retries 5xx and 429", func(t *testing.T) {
+		server, requests := stub(http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK)
+		defer server.Close()
+
+		assert.NoError(t, p.request(http.MethodGet, server.URL, nil, nil))
+		assert.Len(t, *requests, 3)
+		assert.Equal(t, "", (*requests)[0].ContentType)
+	})
+
+	t.Run("gives up after attempts", func(t *testing.T) {
+		server, requests := stub(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+		defer server.Close()
+
+		p := p
+		p.conf.Attempts = 2
+		err := p.request(http.MethodPost, server.URL, []byte("{}"), nil)
+		assert.EqualError(t, err, "test comment: POST "+server.URL+`: 503 Service Unavailable: {"message": "nope"}`)
+		assert.Len(t, *requests, 2)
+	})
+
+	t.Run("no retry on 4xx", func(t *testing.T) {
+		server, requests := stub(http.StatusForbidden)
+		defer server.Close()
+
+		err := p.request(http.MethodPost, server.URL, []byte("{}"), nil)
+		assert.ErrorContains(t, err, "403 Forbidden")
+		assert.Len(t, *requests, 1)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		p := p
+		p.conf = PublishConf{Timeout: "10ms", Attempts: 1}
+		err := p.request(http.MethodGet, server.URL, nil, nil)
+		assert.ErrorContains(t, err, "test comment: GET "+server.URL+": ")
+		assert.ErrorContains(t, err, "Client.Timeout exceeded")
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		server, requests := stub()
+		defer server.Close()
+
+		var out bytes.Buffer
+		p := p
+		p.conf.DryRun = true
+		p.out = &out
+		assert.NoError(t, p.request(http.MethodPost, server.URL+"/comments", map[string]string{"body": "hi"}, nil))
+		assert.Empty(t, *requests)
+		assert.Equal(t, "[dry-run] test comment: POST "+server.URL+"/comments\nAccept: application/json\nAuthorization: ***\n{\"body\":\"hi\"}\n", out.String())
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, retryAfter("2"))
+	assert.Equal(t, publishMaxRetryAfter, retryAfter("3600"))
+	assert.Equal(t, time.Duration(0), retryAfter(""))
+	assert.Equal(t, time.Duration(0), retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+}
+
+func TestPublishConfValidate(t *testing.T) {
+	assert.NoError(t, PublishConf{}.validate())
+	assert.NoError(t, PublishConf{Timeout: "30s"}.validate())
+	assert.ErrorContains(t, PublishConf{Timeout: "long"}.validate(), "invalid publish timeout")
+}
+
+func TestFailureAnnotations(t *testing.T) {
+	pkgsMap := map[string]Package{"mod/pkg": {Dir: "/src/pkg"}}
+	result := RunResult{
+		Tests: []TestResult{
+			{Package: "mod/pkg", Name: "TestWorse", Status: "fail", Output: []string{"    pkg_test.go:30: boom"}},
+			{Package: "mod/pkg", Name: "TestBad", Status: "fail", Output: []string{"    pkg_test.go:12: want 1"}},
+			{Package: "mod/pkg", Name: "TestBad/sub", Status: "fail", Output: []string{"    pkg_test.go:12: want 2"}},
+			{Package: "mod/pkg", Name: "TestGood", Status: "pass", Output: []string{"    pkg_test.go:40: log"}},
+		},
+	}
+
+	assert.Equal(t, []Annotation{
+		{File: "/src/pkg/pkg_test.go", Line: 12, Body: "❌ **Test failed**\n\n`mod/pkg` TestBad\n```\nwant 1\n```\n\n`mod/pkg` TestBad/sub\n```\nwant 2\n```"},
+		{File: "/src/pkg/pkg_test.go", Line: 30, Body: "❌ **Test failed**\n\n`mod/pkg` TestWorse\n```\nboom\n```"},
+	}, failureAnnotations(result, pkgsMap))
+
+	assert.Empty(t, failureAnnotations(RunResult{}, pkgsMap))
+}
+
+func TestSelectPublisher(t *testing.T) {
+	opts := RunTestsOpts{
+		Azure:     AzureConf{URL: "azure"},
+		Bitbucket: BitbucketConf{URL: "bitbucket"},
+		Gitea:     GiteaConf{URL: "gitea"},
+		GitHub:    GitHubConf{APIURL: "github"},
+		GitLab:    GitLabConf{APIURL: "gitlab"},
+	}
+
+	p, err := selectPublisher(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, opts.Azure, p)
+
+	opts.Bitbucket.Pipelines = true
+	p, _ = selectPublisher(opts)
+	assert.Equal(t, opts.Bitbucket, p)
+
+	opts.GitLab.CI = true
+	p, _ = selectPublisher(opts)
+	assert.Equal(t, opts.GitLab, p)
+
+	opts.GitHub.Actions = true
+	p, _ = selectPublisher(opts)
+	assert.Equal(t, opts.GitHub, p)
+
+	opts.Gitea.Actions = true
+	p, _ = selectPublisher(opts)
+	assert.Equal(t, opts.Gitea, p, "Gitea Actions sets GITHUB_ACTIONS too")
+
+	opts.Publish.Provider = "azure"
+	p, _ = selectPublisher(opts)
+	assert.Equal(t, opts.Azure, p)
+
+	opts.Publish.Provider = "gitlab"
+	p, _ = selectPublisher(opts)
+	assert.Equal(t, opts.GitLab, p)
+
+	opts.Publish.Provider = "gerrit"
+	_, err = selectPublisher(opts)
+	assert.EqualError(t, err, "unknown publish provider 'gerrit' (azure, bitbucket, gitea, github, gitlab)")
+}
+
+type fakePublisher struct {
+	features       PublishFeatures
+	ready          error
+	annotationsErr error
+	commentErr     error
+	calls          *[]string
+}
+
+func (f fakePublisher) Features() PublishFeatures { return f.features }
+
+func (f fakePublisher) Ready() error { return f.ready }
+
+func (f fakePublisher) PublishComment(body string, failed bool) error {
+	*f.calls = append(*f.calls, sf("comment failed=%v %s", failed, body))
+	return f.commentErr
+}
+
+func (f fakePublisher) PublishAnnotations(annotations []Annotation) error {
+	*f.calls = append(*f.calls, sf("annotations %d", len(annotations)))
+	return f.annotationsErr
+}
+
+func (f fakePublisher) PublishStatus(failed bool, description string) error {
+	*f.calls = append(*f.calls, sf("status failed=%v %s", failed, description))
+	return nil
+}
+
+func TestPublishReporter(t *testing.T) {
+	result := RunResult{
+		Tests:         []TestResult{{Package: "mod/pkg", Name: "TestBad", Status: "fail", Output: []string{"    pkg_test.go:12: want 1"}}},
+		FailedTests:   []string{"mod/pkg.TestBad"},
+		TotalCoverage: 75,
+	}
+	tmpl, err := parseTemplate("comment", "coverage {{percent .TotalCoverage}}")
+	assert.NoError(t, err)
+
+	calls := []string{}
+	r := publishReporter{publisher: fakePublisher{calls: &calls}, comment: commentTemplate{tmpl: tmpl}}
+	assert.NoError(t, r.OnSummary(result))
+	assert.Empty(t, calls)
+	r.required = true
+	assert.EqualError(t, r.OnSummary(result), "publishing was requested but the provider has no comment, inlineComments or status enabled")
+	r.required = false
+
+	r.publisher = fakePublisher{features: PublishFeatures{Comment: true, InlineComments: true, Status: true}, calls: &calls}
+	assert.NoError(t, r.OnSummary(result))
+	assert.Equal(t, []string{
+		"comment failed=true coverage 75.00%",
+		"status failed=true 1 tests failed, 0 packages failed · coverage 75.00%",
+		"annotations 1",
+	}, calls)
+
+	// the inline comments fail eg. on lines outside the diff, a comment failure does not stop the status
+	calls = []string{}
+	lines := []string{}
+	r.lineOut = func(str ...string) { lines = append(lines, str...) }
+	r.publisher = fakePublisher{features: PublishFeatures{Comment: true, InlineComments: true, Status: true}, annotationsErr: errors.New("github: 422 line not in the diff"), calls: &calls}
+	assert.NoError(t, r.OnSummary(result))
+	assert.Len(t, calls, 3)
+	assert.Equal(t, []string{"WARN: failed to publish inline comments: github: 422 line not in the diff"}, lines)
+
+	calls = []string{}
+	r.publisher = fakePublisher{features: PublishFeatures{Comment: true, Status: true}, commentErr: errors.New("github: 500"), calls: &calls}
+	assert.EqualError(t, r.OnSummary(result), "github: 500")
+	assert.Len(t, calls, 2, "status still set")
+
+	assert.Equal(t, "Tests passed · coverage 80.00%", statusDescription(RunResult{TotalCoverage: 80}))
+	assert.Equal(t, "1 packages below their coverage threshold · coverage 80.00%", statusDescription(RunResult{TotalCoverage: 80, BelowCoverage: []string{"mod/db 40.0% < 80.0%"}}))
+
+	// without the pull request details eg. a local run
+	calls = []string{}
+	lines = []string{}
+	r.publisher = fakePublisher{features: PublishFeatures{Comment: true}, ready: errors.New("azure comment: threads url and token are required"), calls: &calls}
+	r.lineOut = func(str ...string) { lines = append(lines, str...) }
+	assert.NoError(t, r.OnSummary(result))
+	assert.Empty(t, calls)
+	assert.Equal(t, []string{"Skipped publishing to the pull request: azure comment: threads url and token are required"}, lines)
+
+	r.required = true
+	assert.EqualError(t, r.OnSummary(result), "azure comment: threads url and token are required")
+}
+
+func TestListPages(t *testing.T) {
+	urls := []string{}
+	request := func(method, url string, body, out any) error {
+		urls = append(urls, method+" "+url)
+		items := make([]int, ifelse(len(urls) == 1, 100, 3))
+		*(out.(*[]int)) = items
+		return nil
+	}
+
+	items, err := listPages[int](request, pageNumberURL("https://api/items"))
+	assert.NoError(t, err)
+	assert.Len(t, items, 103)
+	assert.Equal(t, []string{"GET https://api/items?per_page=100&page=1", "GET https://api/items?per_page=100&page=2"}, urls)
+
+	_, err = listPages[int](func(method, url string, body, out any) error { return errors.New("nope") }, pageNumberURL("https://api/items"))
+	assert.EqualError(t, err, "nope")
+}
@@ -0,0 +1,68 @@
+package internal
+
+// Reporter receives the progress and outcome of a 'go test' run.
+// Several reporters (terminal, JUnit, PR comments, ...) run together on the same 'go test' stream.
+type Reporter interface {
+	// OnPackageStart is called on the first event of each package
+	OnPackageStart(pkg string)
+	// OnTestEvent is called for each 'go test -json' event
+	OnTestEvent(event TestEvent)
+	// OnPackageDone is called once a package passed, failed or was skipped (no tests)
+	OnPackageDone(pkg PackageResult)
+	// OnSummary is called once with the result of the whole run
+	OnSummary(result RunResult) error
+}
+
+// nopReporter implements Reporter doing nothing. Embed it to only implement the needed hooks.
+type nopReporter struct{}
+
+func (nopReporter) OnPackageStart(pkg string)        {}
+func (nopReporter) OnTestEvent(event TestEvent)      {}
+func (nopReporter) OnPackageDone(pkg PackageResult)  {}
+func (nopReporter) OnSummary(result RunResult) error { return nil }
+
+type processOutputParams struct {
+	OutputChannel   <-chan TestEvent
+	ToTestPackages  []string
+	IgnoredPackages []string
+	NoTestsPackages []Package // packages with a blank test file created (fullCoverage)
+	FlagSkipEmpty   bool
+	CoverProfile    string
+	PackageConfs    map[string]PackageConf // settings of each package, for the coverage thresholds
+	Reporters       []Reporter
+}
+
+// processOutput collects the results of the 'go test' events and dispatches them to each reporter.
+// Returns the run result and the first error returned by a reporter summary.
+func processOutput(params *processOutputParams) (RunResult, error) {
+	collector := newResultCollector(params)
+
+	for event := range params.OutputChannel {
+		started, done := collector.addEvent(event)
+
+		for _, r := range params.Reporters {
+			if started {
+				r.OnPackageStart(event.Package)
+			}
+
+			r.OnTestEvent(event)
+
+			if done != nil {
+				r.OnPackageDone(*done)
+			}
+		}
+	}
+
+	result := collector.result(params.CoverProfile)
+	result.BelowCoverage = belowCoverage(result, params.PackageConfs)
+
+	var reportErr error
+	for _, r := range params.Reporters {
+		err := r.OnSummary(result)
+		if err != nil && reportErr == nil {
+			reportErr = err
+		}
+	}
+
+	return result, reportErr
+}
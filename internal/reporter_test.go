@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordReporter struct {
+	calls []string
+	err   error
+}
+
+func (r *recordReporter) OnPackageStart(pkg string) { r.calls = append(r.calls, "start "+pkg) }
+func (r *recordReporter) OnTestEvent(event TestEvent) {
+	r.calls = append(r.calls, "event "+event.Action)
+}
+func (r *recordReporter) OnPackageDone(pkg PackageResult) {
+	r.calls = append(r.calls, "done "+pkg.Name+" "+pkg.Status)
+}
+func (r *recordReporter) OnSummary(result RunResult) error {
+	r.calls = append(r.calls, sf("summary %d", result.TestedPackages))
+	return r.err
+}
+
+type summaryReporter struct {
+	nopReporter
+	onSummary func(result RunResult)
+}
+
+func (r *summaryReporter) OnSummary(result RunResult) error {
+	r.onSummary(result)
+	return nil
+}
+
+func TestProcessOutputReporters(t *testing.T) {
+	events := make(chan TestEvent)
+	go func() {
+		events <- TestEvent{Action: "start", Package: "tst"}
+		events <- TestEvent{Action: "run", Package: "tst", Test: "TestGood"}
+		events <- TestEvent{Action: "pass", Package: "tst", Test: "TestGood"}
+		events <- TestEvent{Action: "pass", Package: "tst", Elapsed: 0.1}
+		close(events)
+	}()
+
+	one := &recordReporter{}
+	two := &recordReporter{err: errors.New("failed to report")}
+	three := &recordReporter{}
+
+	result, err := processOutput(&processOutputParams{
+		OutputChannel:  events,
+		ToTestPackages: []string{"tst"},
+		Reporters:      []Reporter{one, two, three},
+	})
+
+	expected := []string{
+		"start tst",
+		"event start",
+		"event run",
+		"event pass",
+		"event pass",
+		"done tst pass",
+		"summary 1",
+	}
+
+	assert.EqualError(t, err, "failed to report")
+	assert.Equal(t, expected, one.calls)
+	assert.Equal(t, expected, two.calls)
+	assert.Equal(t, expected, three.calls) // all reporters get the summary
+	assert.Len(t, result.Packages, 1)
+	assert.Len(t, result.Tests, 1)
+}
+
+func TestProcessOutputBelowCoverage(t *testing.T) {
+	events := make(chan TestEvent)
+	go func() {
+		events <- TestEvent{Action: "output", Package: "tst", Output: "coverage: 40.0% of statements\n"}
+		events <- TestEvent{Action: "pass", Package: "tst", Elapsed: 0.1}
+		close(events)
+	}()
+
+	var summary RunResult
+	reporter := &summaryReporter{onSummary: func(result RunResult) { summary = result }}
+
+	result, err := processOutput(&processOutputParams{
+		OutputChannel:  events,
+		ToTestPackages: []string{"tst"},
+		PackageConfs:   map[string]PackageConf{"tst": {Coverage: 80}},
+		Reporters:      []Reporter{reporter},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tst 40.0% < 80.0%"}, result.BelowCoverage)
+	assert.Equal(t, result.BelowCoverage, summary.BelowCoverage, "the reporters see the failed thresholds")
+	assert.True(t, summary.failed())
+}
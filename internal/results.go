@@ -0,0 +1,252 @@
+package internal
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// TestResult is the outcome of a single test (or subtest) of a package
+type TestResult struct {
+	Package string
+	Name    string
+	Status  string // pass, fail or skip
+	Elapsed float64
+	Output  []string
+}
+
+// isPanic checks if the test output holds a panic
+func (t TestResult) isPanic() bool {
+	for _, l := range t.Output {
+		if regexPanic.MatchString(l) {
+			return true
+		}
+	}
+	return false
+}
+
+// PackageResult is the outcome of a tested package
+type PackageResult struct {
+	Name         string
+	Status       string // pass, fail or skip (no test files)
+	Start        time.Time
+	Elapsed      float64
+	Coverage     string // eg. "75.0%" or empty if not reported
+	NoStatements bool   // coverage reported as '[no statements]'
+	NoTests      bool
+	FailedBuild  bool
+	Output       []string // package level output eg. build errors or panics outside of tests
+}
+
+// RunResult is the outcome of a whole 'go test' run
+type RunResult struct {
+	Packages         []PackageResult
+	Tests            []TestResult
+	TestedPackages   int
+	FailedPackages   []string
+	NoTestsPackages  []string
+	IgnoredPackages  []string
+	FailedTests      []string // names of the failed tests, sorted
+	BelowCoverage    []string // packages below their 'coverage' setting eg. "mod/db 40.0% < 80.0%", sorted
+	TotalCoverage    float64
+	CoverageAccurate bool // calculated from the cover profile instead of averaging the packages coverage
+}
+
+// failed tells if the run fails: failed tests or packages, or packages below their coverage
+func (r RunResult) failed() bool {
+	return len(r.FailedTests) > 0 || len(r.FailedPackages) > 0 || len(r.BelowCoverage) > 0
+}
+
+// packageTests returns the results of the tests of package 'pkg'
+func (r RunResult) packageTests(pkg string) []TestResult {
+	tests := []TestResult{}
+	for _, t := range r.Tests {
+		if t.Package == pkg {
+			tests = append(tests, t)
+		}
+	}
+	return tests
+}
+
+// resultCollector builds the run result from the 'go test' events
+type resultCollector struct {
+	res         RunResult
+	noTestsPkgs map[string]bool // packages with a blank test file created (fullCoverage)
+	skipEmpty   bool
+	coverages   []float64 // packages coverage, to average when there's no cover profile
+
+	starts       map[string]time.Time
+	pkgCoverages map[string]string
+	testOutputs  map[string][]string
+	pkgOutputs   map[string][]string
+	buildOutputs map[string][]string
+	running      map[string][]string
+}
+
+func newResultCollector(params *processOutputParams) *resultCollector {
+	noTestsPkgs := map[string]bool{}
+	for _, p := range params.NoTestsPackages {
+		noTestsPkgs[p.ImportPath] = true
+	}
+
+	return &resultCollector{
+		res: RunResult{
+			Packages:        []PackageResult{},
+			Tests:           []TestResult{},
+			TestedPackages:  len(params.ToTestPackages),
+			FailedPackages:  []string{},
+			NoTestsPackages: []string{},
+			IgnoredPackages: params.IgnoredPackages,
+		},
+		noTestsPkgs:  noTestsPkgs,
+		skipEmpty:    params.FlagSkipEmpty,
+		coverages:    []float64{},
+		starts:       map[string]time.Time{},
+		pkgCoverages: map[string]string{},
+		testOutputs:  map[string][]string{},
+		pkgOutputs:   map[string][]string{},
+		buildOutputs: map[string][]string{},
+		running:      map[string][]string{},
+	}
+}
+
+// addEvent records a single 'go test' event.
+// Returns if the event is the first of its package and the package result if the event completes the package.
+func (c *resultCollector) addEvent(event TestEvent) (bool, *PackageResult) {
+	if event.Action == "build-output" {
+		c.buildOutputs[event.ImportPath] = append(c.buildOutputs[event.ImportPath], trimOutput(event.Output))
+		return false, nil
+	}
+
+	if event.Package == "" {
+		return false, nil
+	}
+
+	_, seen := c.starts[event.Package]
+	if !seen {
+		c.starts[event.Package] = event.Time
+	}
+
+	testKey := event.Package + " " + event.Test
+
+	switch event.Action {
+	case "run":
+		c.running[event.Package] = append(c.running[event.Package], event.Test)
+
+	case "output":
+		line := trimOutput(event.Output)
+		switch {
+		case regexRunLine.MatchString(line), regexTestSummary.MatchString(line):
+			// frame lines, not part of the test output
+
+		case event.Test != "":
+			c.testOutputs[testKey] = append(c.testOutputs[testKey], line)
+
+		case regexCoverageAny.MatchString(event.Output):
+			c.pkgCoverages[event.Package] = event.Output
+
+		case regexPackageSummary.MatchString(line),
+			regexPassFailLine.MatchString(line),
+			regexNoTests.MatchString(line):
+			// package summary lines
+
+		default:
+			c.pkgOutputs[event.Package] = append(c.pkgOutputs[event.Package], line)
+		}
+
+	case "pass", "fail", "skip":
+		if event.Test != "" {
+			c.addTest(event.Package, event.Test, event.Action, event.Elapsed)
+			return !seen, nil
+		}
+
+		pkg := c.addPackage(event)
+		return !seen, &pkg
+	}
+
+	return !seen, nil
+}
+
+func (c *resultCollector) addTest(pkg, test, status string, elapsed float64) {
+	testKey := pkg + " " + test
+	c.res.Tests = append(c.res.Tests, TestResult{
+		Package: pkg,
+		Name:    test,
+		Status:  status,
+		Elapsed: elapsed,
+		Output:  c.testOutputs[testKey],
+	})
+	delete(c.testOutputs, testKey)
+
+	running := c.running[pkg][:0]
+	for _, t := range c.running[pkg] {
+		if t != test {
+			running = append(running, t)
+		}
+	}
+	c.running[pkg] = running
+}
+
+func (c *resultCollector) addPackage(event TestEvent) PackageResult {
+	// tests that never reported an outcome (eg. panics) are counted as failed
+	for _, test := range append([]string{}, c.running[event.Package]...) {
+		c.addTest(event.Package, test, "fail", 0)
+	}
+
+	pkg := PackageResult{
+		Name:        event.Package,
+		Status:      event.Action,
+		Start:       c.starts[event.Package],
+		Elapsed:     event.Elapsed,
+		FailedBuild: event.FailedBuild != "",
+		Output:      c.pkgOutputs[event.Package],
+	}
+
+	if event.FailedBuild != "" {
+		pkg.Output = append(append([]string{}, c.buildOutputs[event.FailedBuild]...), pkg.Output...)
+	}
+
+	switch {
+	case event.Action == "skip" || (event.Action == "pass" && c.noTestsPkgs[event.Package]):
+		pkg.NoTests = true
+		c.res.NoTestsPackages = append(c.res.NoTestsPackages, event.Package)
+		if !c.skipEmpty {
+			c.coverages = append(c.coverages, 0)
+		}
+
+	case regexCoverageNoStatements.MatchString(c.pkgCoverages[event.Package]):
+		pkg.NoStatements = true
+
+	default:
+		pkg.Coverage = regexCoverageNonZero.ReplaceAllString(c.pkgCoverages[event.Package], "$1")
+		c.coverages = append(c.coverages, coverageParse(pkg.Coverage))
+	}
+
+	if event.Action == "fail" {
+		c.res.FailedPackages = append(c.res.FailedPackages, event.Package)
+	}
+
+	c.res.Packages = append(c.res.Packages, pkg)
+	return pkg
+}
+
+// result completes the run result with the failed tests and total coverage
+func (c *resultCollector) result(coverProfile string) RunResult {
+	failedTests := map[string]bool{}
+	for _, t := range c.res.Tests {
+		if t.Status == "fail" {
+			failedTests[t.Name] = true
+		}
+	}
+	c.res.FailedTests = mapSortedKeys(failedTests)
+
+	totalCoverage, isAvg := getTotalCoverage(coverProfile, c.coverages)
+	c.res.TotalCoverage = totalCoverage
+	c.res.CoverageAccurate = !isAvg
+
+	return c.res
+}
+
+func trimOutput(str string) string {
+	return strings.TrimRightFunc(str, unicode.IsSpace)
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectResults(params *processOutputParams, events ...TestEvent) RunResult {
+	c := newResultCollector(params)
+	for _, e := range events {
+		c.addEvent(e)
+	}
+	return c.result("")
+}
+
+func TestResultCollector(t *testing.T) {
+	t.Run("tests and package", func(t *testing.T) {
+		result := collectResults(&processOutputParams{ToTestPackages: []string{"tst"}},
+			TestEvent{Action: "start", Package: "tst"},
+			TestEvent{Action: "run", Package: "tst", Test: "TestGood"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestGood", Output: "=== RUN   TestGood\n"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestGood", Output: "    code_test.go:5: some log\n"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestGood", Output: "--- PASS: TestGood (0.01s)\n"},
+			TestEvent{Action: "pass", Package: "tst", Test: "TestGood", Elapsed: 0.01},
+			TestEvent{Action: "run", Package: "tst", Test: "TestBad"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestBad", Output: "=== RUN   TestBad\n"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestBad", Output: "    code_test.go:12: nope\n"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestBad", Output: "--- FAIL: TestBad (0.00s)\n"},
+			TestEvent{Action: "fail", Package: "tst", Test: "TestBad", Elapsed: 0},
+			TestEvent{Action: "output", Package: "tst", Output: "FAIL\n"},
+			TestEvent{Action: "output", Package: "tst", Output: "coverage: 50.0% of statements\n"},
+			TestEvent{Action: "output", Package: "tst", Output: "FAIL\ttst\t0.108s\n"},
+			TestEvent{Action: "fail", Package: "tst", Elapsed: 0.108},
+		)
+
+		assert.Equal(t, []TestResult{
+			{Package: "tst", Name: "TestGood", Status: "pass", Elapsed: 0.01, Output: []string{"    code_test.go:5: some log"}},
+			{Package: "tst", Name: "TestBad", Status: "fail", Elapsed: 0, Output: []string{"    code_test.go:12: nope"}},
+		}, result.Tests)
+		assert.Equal(t, []PackageResult{
+			{Name: "tst", Status: "fail", Elapsed: 0.108, Coverage: "50.0%"},
+		}, result.Packages)
+		assert.Equal(t, 1, result.TestedPackages)
+		assert.Equal(t, []string{"tst"}, result.FailedPackages)
+		assert.Equal(t, []string{"TestBad"}, result.FailedTests)
+		assert.Equal(t, 50.0, result.TotalCoverage)
+		assert.False(t, result.CoverageAccurate)
+	})
+
+	t.Run("build failed", func(t *testing.T) {
+		result := collectResults(&processOutputParams{ToTestPackages: []string{"tst"}},
+			TestEvent{Action: "build-output", ImportPath: "tst", Output: "# tst\n"},
+			TestEvent{Action: "build-output", ImportPath: "tst", Output: "code.go:2:10: undefined: x\n"},
+			TestEvent{Action: "build-fail", ImportPath: "tst"},
+			TestEvent{Action: "output", Package: "tst", Output: "FAIL\ttst [build failed]\n"},
+			TestEvent{Action: "fail", Package: "tst", FailedBuild: "tst"},
+		)
+
+		assert.Empty(t, result.Tests)
+		assert.Equal(t, []PackageResult{
+			{Name: "tst", Status: "fail", FailedBuild: true, Output: []string{"# tst", "code.go:2:10: undefined: x"}},
+		}, result.Packages)
+	})
+
+	t.Run("coverpkg coverage", func(t *testing.T) {
+		result := collectResults(&processOutputParams{ToTestPackages: []string{"tst"}},
+			TestEvent{Action: "output", Package: "tst", Output: "coverage: 85.5% of statements in ./...\n"},
+			TestEvent{Action: "pass", Package: "tst", Elapsed: 0.1},
+		)
+
+		assert.Equal(t, "85.5%", result.Packages[0].Coverage)
+		assert.Empty(t, belowCoverage(result, map[string]PackageConf{"tst": {Coverage: 80}}))
+	})
+
+	t.Run("test without outcome counts as failed", func(t *testing.T) {
+		result := collectResults(&processOutputParams{ToTestPackages: []string{"tst"}},
+			TestEvent{Action: "run", Package: "tst", Test: "TestPanic"},
+			TestEvent{Action: "output", Package: "tst", Test: "TestPanic", Output: "panic: boom\n"},
+			TestEvent{Action: "fail", Package: "tst", Elapsed: 0.1},
+		)
+
+		assert.Equal(t, []TestResult{
+			{Package: "tst", Name: "TestPanic", Status: "fail", Output: []string{"panic: boom"}},
+		}, result.Tests)
+		assert.True(t, result.Tests[0].isPanic())
+	})
+
+	t.Run("no tests packages", func(t *testing.T) {
+		params := &processOutputParams{
+			ToTestPackages:  []string{"one", "two", "three"},
+			NoTestsPackages: []Package{{ImportPath: "two"}},
+		}
+		events := []TestEvent{
+			{Action: "output", Package: "one", Output: "coverage: 90.0% of statements\n"},
+			{Action: "pass", Package: "one", Elapsed: 0.1},
+			{Action: "pass", Package: "two", Elapsed: 0.1},
+			{Action: "skip", Package: "three"},
+		}
+
+		result := collectResults(params, events...)
+		assert.Equal(t, []string{"two", "three"}, result.NoTestsPackages)
+		assert.True(t, result.Packages[1].NoTests)
+		assert.Equal(t, 30.0, result.TotalCoverage) // no tests packages count as 0% coverage
+
+		params.FlagSkipEmpty = true
+		result = collectResults(params, events...)
+		assert.Equal(t, 90.0, result.TotalCoverage)
+	})
+
+	t.Run("package start and done", func(t *testing.T) {
+		c := newResultCollector(&processOutputParams{ToTestPackages: []string{"tst"}})
+
+		started, done := c.addEvent(TestEvent{Action: "start", Package: "tst"})
+		assert.True(t, started)
+		assert.Nil(t, done)
+
+		started, done = c.addEvent(TestEvent{Action: "pass", Package: "tst", Elapsed: 0.2})
+		assert.False(t, started)
+		assert.Equal(t, &PackageResult{Name: "tst", Status: "pass", Elapsed: 0.2}, done)
+	})
+}
@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// configSchemaURL is the published config JSON Schema, referenced by the configs 'gotestiful init' creates
+const configSchemaURL = "https://raw.githubusercontent.com/alex-parra/gotestiful/main/gotestiful.schema.json"
+
+// configDescriptions describes the config keys without a flag, the others take the flag help.
+// Keys of list items and map values are the parent key and the item key eg. 'notify.url'.
+var configDescriptions = map[string]string{
+	"version":                  "Config format version, older files load with a warning until migrated with 'gotestiful config migrate'",
+	"output":                   "Terminal output settings",
+	"coverage":                 "Coverage settings",
+	"include":                  "Packages to test: import path regexes, globs eg. '**/api' or directories eg. './internal/...', '!' negates an entry. All if empty",
+	"exclude":                  "Packages to ignore: import path regexes, globs eg. '**/mocks' or directories eg. './internal/gen/...', '!' negates an entry",
+	"notify":                   "Webhooks called after the run",
+	"notify.name":              "Shown in errors, defaults to the url host",
+	"notify.url":               "Webhook url, ${ENV} variables are expanded",
+	"notify.method":            "HTTP method, defaults to POST",
+	"notify.headers":           "Request headers, ${ENV} variables are expanded eg. \"Authorization\": \"Bearer ${TOKEN}\"",
+	"notify.body":              "JSON text/template over the run summary, defaults to the json summary",
+	"notify.onFailure":         "Notify when tests fail",
+	"notify.onCoverageDrop":    "Notify when the total coverage is lower than the baseline",
+	"notify.timeout":           "Per attempt eg. 5s, defaults to the 'publish' timeout",
+	"notify.attempts":          "Attempts on network errors, 5xx and 429, defaults to the 'publish' attempts",
+	"packages":                 "go test settings of the packages matching each key (an include/exclude pattern), the more specific keys override (see the README)",
+	"packages.timeout":         "go test -timeout eg. 10m",
+	"packages.tags":            "Build tags eg. integration",
+	"packages.env":             "Environment variables of the go test run",
+	"packages.args":            "Extra go test args eg. -race",
+	"packages.coverage":        "Minimum coverage percentage, the run fails if a package is below it",
+	"packages.cache":           "false to always run the tests, overrides the 'cache' setting",
+	"azure":                    "Azure DevOps pull request publishing",
+	"azure.status":             "Azure DevOps PR status: set a pull request status",
+	"azure.url":                "Azure DevOps PR comment: pull request threads url, derived from the pipeline variables if empty",
+	"bitbucket":                "Bitbucket Cloud and Server pull request publishing, the token is read from BITBUCKET_TOKEN",
+	"bitbucket.comment":        "Bitbucket PR comment: publish coverage and failed tests as a pull request comment",
+	"bitbucket.inlineComments": "Bitbucket inline PR comments: publish a comment at the file line of each test failure",
+	"bitbucket.status":         "Bitbucket build status: set the build status of the pull request commit",
+	"bitbucket.url":            "Bitbucket Server url eg. https://bitbucket.example.com, Bitbucket Cloud if empty",
+	"bitbucket.project":        "Server project key or Cloud workspace, defaults to BITBUCKET_WORKSPACE",
+	"bitbucket.repository":     "Repository slug, defaults to BITBUCKET_REPO_SLUG",
+	"gitea":                    "Gitea pull request publishing, the token is read from GITEA_TOKEN",
+	"gitea.comment":            "Gitea PR comment: publish coverage and failed tests as a pull request comment",
+	"gitea.inlineComments":     "Gitea PR review: publish a review comment at the file line of each test failure",
+	"gitea.status":             "Gitea commit status: set the status of the pull request commit",
+	"gitea.url":                "Gitea server url eg. https://gitea.example.com, defaults to GITHUB_SERVER_URL in Gitea Actions",
+	"github":                   "GitHub pull request publishing, the token is read from GITHUB_TOKEN",
+	"github.inlineComments":    "GitHub PR review comments: publish a comment at the file line of each test failure",
+	"github.status":            "GitHub commit status: set the status of the pull request head commit",
+	"gitlab":                   "GitLab merge request publishing, the token is read from GITLAB_TOKEN",
+	"gitlab.inlineComments":    "GitLab MR discussions: open a discussion at the file line of each test failure",
+	"gitlab.status":            "GitLab commit status: set the status of the pipeline commit",
+	"gitlab.apiUrl":            "GitLab v4 REST API url eg. https://gitlab.example.com/api/v4, defaults to CI_API_V4_URL",
+	"publish":                  "Pull request and webhook requests settings",
+	"publish.timeout":          "Per attempt eg. 5s, defaults to 10s",
+	"publish.attempts":         "Attempts on network errors, 5xx and 429, defaults to 3",
+	"profiles":                 "Named partial configs eg. 'ci', selected with -profile or GOTESTIFUL_PROFILE",
+}
+
+// configEnums are the allowed values of the keys with a fixed set
+var configEnums = map[string][]any{
+	"publish.provider": {"", "azure", "bitbucket", "gitea", "github", "gitlab"},
+}
+
+// ConfigSchema generates the config JSON Schema from the config types, so it follows them as keys are added.
+// 'flagUsage' is the help of each flag, the description of its config key.
+func ConfigSchema(flagUsage map[string]string) ([]byte, error) {
+	descriptions := mapMerge(configDescriptions)
+	for flagName, key := range configFlags {
+		if usage := flagUsage[flagName]; usage != "" {
+			descriptions[key] = usage
+		}
+	}
+
+	schema := schemaObject(reflect.ValueOf(conf), "", descriptions)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = configSchemaURL
+	schema["title"] = "gotestiful config"
+	schema["properties"].(map[string]any)["$schema"] = map[string]any{"type": "string", "description": "JSON Schema of the config, for editors"}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the config schema: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// PrintSchema prints the config JSON Schema
+func PrintSchema(flagUsage map[string]string) error {
+	data, err := ConfigSchema(flagUsage)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// withSchemaReference adds the config JSON Schema reference to the encoded config 'data' so editors autocomplete and validate it:
+// the '$schema' key in json, the comments of the YAML (yaml-language-server) and TOML (taplo) language servers.
+func withSchemaReference(data []byte, format string) []byte {
+	switch format {
+	case "yaml":
+		return append([]byte("# yaml-language-server: $schema="+configSchemaURL+"\n"), data...)
+	case "toml":
+		return append([]byte("#:schema "+configSchemaURL+"\n"), data...)
+	default:
+		return append([]byte(sf("{\n  \"$schema\": %q,", configSchemaURL)), bytes.TrimPrefix(data, []byte("{"))...)
+	}
+}
+
+// schemaObject returns the schema of the struct 'v', its field values are the defaults
+func schemaObject(v reflect.Value, prefix string, descriptions map[string]string) map[string]any {
+	properties := map[string]any{}
+
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+			switch {
+			case name == "-" || !field.IsExported():
+			case field.Anonymous && name == "":
+				walk(v.Field(i)) // flattened eg. PublishFeatures
+			default:
+				key := prefix + name
+				property := schemaType(v.Field(i), key, descriptions)
+				if enum, ok := configEnums[key]; ok {
+					property["enum"] = enum
+				}
+				if desc := descriptions[key]; desc != "" {
+					property["description"] = desc
+				}
+				properties[name] = property
+			}
+		}
+	}
+	walk(v)
+
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// schemaType returns the schema of the config 'key' value 'v', list items and map values keep the key of their parent
+func schemaType(v reflect.Value, key string, descriptions map[string]string) map[string]any {
+	elem := func() reflect.Value { return reflect.New(v.Type().Elem()).Elem() }
+
+	switch {
+	case key == "profiles":
+		return map[string]any{"type": "object", "additionalProperties": map[string]any{"$ref": "#"}}
+
+	case v.Kind() == reflect.Pointer:
+		return schemaType(elem(), key, descriptions)
+
+	case v.Kind() == reflect.Struct:
+		return schemaObject(v, key+".", descriptions)
+
+	case v.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaType(elem(), key, descriptions)}
+
+	case v.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaType(elem(), key, descriptions)}
+
+	default:
+		schema := map[string]any{"type": map[reflect.Kind]string{
+			reflect.Bool:    "boolean",
+			reflect.Int:     "integer",
+			reflect.Float64: "number",
+			reflect.String:  "string",
+		}[v.Kind()]}
+		if !v.IsZero() {
+			schema["default"] = v.Interface()
+		}
+		return schema
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// schemaUsage is a help text for each flag of a config key
+func schemaUsage() map[string]string {
+	usage := map[string]string{}
+	for name := range configFlags {
+		usage[name] = "flag -" + name
+	}
+	return usage
+}
+
+// schemaProperties walks the 'schema' properties, list items and map values, calling 'fn' with the dotted key of each
+func schemaProperties(schema map[string]any, prefix string, fn func(key string, prop map[string]any)) {
+	props, _ := schema["properties"].(map[string]any)
+	for name, p := range props {
+		prop := p.(map[string]any)
+		fn(prefix+name, prop)
+
+		for _, nested := range []any{prop, prop["items"], prop["additionalProperties"]} {
+			if n, ok := nested.(map[string]any); ok {
+				schemaProperties(n, prefix+name+".", fn)
+			}
+		}
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	t.Parallel()
+
+	data, err := ConfigSchema(schemaUsage())
+	assert.NoError(t, err)
+
+	var schema map[string]any
+	assert.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, configSchemaURL, schema["$id"])
+	assert.Equal(t, false, schema["additionalProperties"])
+
+	props := map[string]map[string]any{}
+	schemaProperties(schema, "", func(key string, prop map[string]any) {
+		props[key] = prop
+		assert.NotEmpty(t, prop["description"], "%s has no description, add it to configDescriptions", key)
+	})
+
+	assert.Equal(t, map[string]any{"type": "boolean", "default": true, "description": "flag -cache"}, props["cache"])
+	assert.Equal(t, map[string]any{"type": "boolean", "description": "flag -v"}, props["output.verbose"])
+	assert.Equal(t, "array", props["exclude"]["type"])
+	assert.Equal(t, map[string]any{"type": "string"}, props["exclude"]["items"])
+	assert.Equal(t, []any{"", "azure", "bitbucket", "gitea", "github", "gitlab"}, props["publish.provider"]["enum"])
+	assert.Equal(t, "number", props["packages.coverage"]["type"])
+	assert.Equal(t, "boolean", props["packages.cache"]["type"])
+	assert.Equal(t, map[string]any{"$ref": "#"}, props["profiles"]["additionalProperties"])
+	assert.Contains(t, props, "azure.inlineComments")
+	assert.NotContains(t, props, "azure.auth", "not a config key")
+	assert.NotContains(t, props, "bitbucket.token", "not a config key")
+}
+
+// TestPublishedConfigSchema checks the published schema follows the config types, regenerate it with 'gotestiful schema'
+func TestPublishedConfigSchema(t *testing.T) {
+	t.Parallel()
+
+	published, err := os.ReadFile(filepath.Join("..", "gotestiful.schema.json"))
+	assert.NoError(t, err)
+	generated, err := ConfigSchema(nil)
+	assert.NoError(t, err)
+
+	keys := func(data []byte) map[string]any {
+		var schema map[string]any
+		assert.NoError(t, json.Unmarshal(data, &schema))
+
+		types := map[string]any{}
+		schemaProperties(schema, "", func(key string, prop map[string]any) {
+			types[key] = []any{prop["type"], prop["default"], prop["enum"]}
+		})
+		return types
+	}
+	assert.Equal(t, keys(generated), keys(published))
+}
+
+func TestWithSchemaReference(t *testing.T) {
+	t.Parallel()
+
+	data, err := encodeConfig(conf, "json")
+	assert.NoError(t, err)
+
+	var values map[string]any
+	assert.NoError(t, json.Unmarshal(withSchemaReference(data, "json"), &values))
+	assert.Equal(t, configSchemaURL, values["$schema"])
+	assert.Equal(t, 2.0, values["version"])
+
+	assert.Equal(t, "# yaml-language-server: $schema="+configSchemaURL+"\ncolor: true\n", string(withSchemaReference([]byte("color: true\n"), "yaml")))
+	assert.Equal(t, "#:schema "+configSchemaURL+"\ncolor = true\n", string(withSchemaReference([]byte("color = true\n"), "toml")))
+
+	// the config files accept the reference
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, configFileName)
+	assert.NoError(t, os.WriteFile(confPath, withSchemaReference(data, "json"), 0o666))
+	c := conf
+	keys, err := readConfigFile(confPath, &c)
+	assert.NoError(t, err)
+	assert.NotContains(t, keys, "$schema")
+}
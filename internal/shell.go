@@ -40,8 +40,14 @@ func shCmd(prog string, args shArgs, stdIn string) (string, error) {
 
 func shJSONPipe[T any](prog string, args shArgs, stdIn string, eventPipe chan<- T, copyOutput io.Writer) error {
 	defer close(eventPipe)
+	return shJSONStream(prog, args, nil, eventPipe, copyOutput)
+}
 
+// shJSONStream runs a shell command with the 'env' environment (nil to inherit it) and sends each JSON line of the output to 'eventPipe'.
+// Unlike shJSONPipe it does not close the channel, so several commands can stream into it.
+func shJSONStream[T any](prog string, args shArgs, env []string, eventPipe chan<- T, copyOutput io.Writer) error {
 	cmd := exec.Command(prog, args...)
+	cmd.Env = env
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to pipe %s: %w", prog, err)
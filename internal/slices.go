@@ -47,3 +47,11 @@ func sliceAppendIf[T any](cond bool, lst []T, args ...T) []T {
 	}
 	return lst
 }
+
+// sliceNonNil returns 'lst' or an empty slice if it's nil (eg. to encode [] instead of null)
+func sliceNonNil[T any](lst []T) []T {
+	if lst == nil {
+		return []T{}
+	}
+	return lst
+}
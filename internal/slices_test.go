@@ -65,3 +65,15 @@ func TestSliceAppendIf(t *testing.T) {
 		assert.Equal(t, expected, actual)
 	})
 }
+
+func TestSliceNonNil(t *testing.T) {
+	t.Run("with nil", func(t *testing.T) {
+		actual := sliceNonNil[string](nil)
+		assert.NotNil(t, actual)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("with values", func(t *testing.T) {
+		assert.Equal(t, []int{1, 2}, sliceNonNil([]int{1, 2}))
+	})
+}
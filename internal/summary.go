@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"sort"
+)
+
+// Summary is the machine readable result of a run, as written by '-summary-json'
+type Summary struct {
+	Version          string           `json:"version"`          // gotestiful version
+	Module           string           `json:"module"`           // module path of the tested code
+	Packages         []SummaryPackage `json:"packages"`         // tested packages in completion order
+	FailedTests      []SummaryTest    `json:"failedTests"`      // tests (and subtests) that failed
+	SkippedTests     []SummaryTest    `json:"skippedTests"`     // tests (and subtests) that were skipped
+	FlakyTests       []SummaryTest    `json:"flakyTests"`       // tests that both failed and passed in the run
+	BelowCoverage    []string         `json:"belowCoverage"`    // packages below their 'coverage' setting eg. "mod/db 40.0% < 80.0%"
+	ExcludedPackages []string         `json:"excludedPackages"` // packages excluded by the config 'exclude' list
+	NoTestsPackages  []string         `json:"noTestsPackages"`  // packages without test files
+	TotalCoverage    float64          `json:"totalCoverage"`    // overall coverage percentage
+	CoverageAccurate bool             `json:"coverageAccurate"` // true if calculated from the cover profile, false if averaged
+}
+
+// SummaryPackage is the result of a single package
+type SummaryPackage struct {
+	Name       string   `json:"name"`
+	Status     string   `json:"status"`               // pass, fail or notests
+	Coverage   *float64 `json:"coverage"`             // coverage percentage, null when not reported
+	Statements int      `json:"statements,omitempty"` // number of statements, only with a cover profile
+	Elapsed    float64  `json:"elapsed"`              // seconds
+	Cached     bool     `json:"cached"`
+}
+
+// SummaryTest is the result of a single test or subtest
+type SummaryTest struct {
+	Package string   `json:"package"`
+	Name    string   `json:"name"`
+	Elapsed float64  `json:"elapsed"` // seconds
+	Output  []string `json:"output"`
+}
+
+// summaryJSONReporter writes the run summary as JSON
+type summaryJSONReporter struct {
+	nopReporter
+	filePath string
+	info     summaryInfo
+}
+
+func (r summaryJSONReporter) OnSummary(result RunResult) error {
+	summary := r.info.build(result)
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to build summary: %w", err)
+	}
+
+	err = os.WriteFile(r.filePath, data, 0o666)
+	if err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// loadSummary reads a summary written by '-summary-json' eg. of the target branch, to compare against
+func loadSummary(filePath string) (*Summary, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+
+	data, err := readFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline summary: %w", err)
+	}
+
+	var summary Summary
+	err = json.Unmarshal(data, &summary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline summary: %w", err)
+	}
+
+	return &summary, nil
+}
+
+// buildSummary converts the run result to a Summary. The statements are counted if there's a cover profile.
+func buildSummary(result RunResult, version, module, coverProfile string) Summary {
+	summary := Summary{
+		Version:          version,
+		Module:           module,
+		Packages:         []SummaryPackage{},
+		FailedTests:      []SummaryTest{},
+		SkippedTests:     []SummaryTest{},
+		FlakyTests:       []SummaryTest{},
+		BelowCoverage:    sliceNonNil(result.BelowCoverage),
+		ExcludedPackages: sliceNonNil(result.IgnoredPackages),
+		NoTestsPackages:  sliceNonNil(result.NoTestsPackages),
+		TotalCoverage:    result.TotalCoverage,
+		CoverageAccurate: result.CoverageAccurate,
+	}
+
+	statements := map[string]int{}
+	if coverProfile != "" && fileExists(coverProfile) {
+		blocks, _ := parseCoverProfile(coverProfile)
+		for _, b := range blocks {
+			statements[path.Dir(b.File)] += b.NumStmt
+		}
+	}
+
+	for _, pkg := range result.Packages {
+		sp := SummaryPackage{
+			Name:       pkg.Name,
+			Status:     ifelse(pkg.NoTests, "notests", pkg.Status),
+			Statements: statements[pkg.Name],
+			Elapsed:    pkg.Elapsed,
+			Cached:     pkg.Status == "pass" && !pkg.NoTests && pkg.Elapsed == 0,
+		}
+
+		if pkg.Coverage != "" {
+			cov := coverageParse(pkg.Coverage)
+			sp.Coverage = &cov
+		}
+
+		summary.Packages = append(summary.Packages, sp)
+	}
+
+	passed := map[string]bool{}
+	for _, t := range result.Tests {
+		if t.Status == "pass" {
+			passed[t.Package+" "+t.Name] = true
+		}
+	}
+
+	flaky := map[string]bool{}
+	for _, t := range result.Tests {
+		st := SummaryTest{Package: t.Package, Name: t.Name, Elapsed: t.Elapsed, Output: sliceNonNil(t.Output)}
+
+		switch t.Status {
+		case "fail":
+			summary.FailedTests = append(summary.FailedTests, st)
+			if testKey := t.Package + " " + t.Name; passed[testKey] && !flaky[testKey] {
+				summary.FlakyTests = append(summary.FlakyTests, st)
+				flaky[testKey] = true
+			}
+		case "skip":
+			summary.SkippedTests = append(summary.SkippedTests, st)
+		}
+	}
+
+	return summary
+}
+
+// CoverageDelta is the coverage change of a package from the baseline
+type CoverageDelta struct {
+	Package string
+	Before  *float64 // nil if the package is new or had no coverage
+	After   *float64 // nil if the package was removed or has no coverage
+	Change  float64
+}
+
+// coverageDeltas compares the packages coverage to the baseline, sorted by the size of the change
+func coverageDeltas(summary, baseline Summary) []CoverageDelta {
+	before := map[string]*float64{}
+	for _, pkg := range baseline.Packages {
+		before[pkg.Name] = pkg.Coverage
+	}
+	after := map[string]*float64{}
+	for _, pkg := range summary.Packages {
+		after[pkg.Name] = pkg.Coverage
+	}
+
+	deltas := []CoverageDelta{}
+	for _, name := range mapSortedKeys(mapMerge(before, after)) {
+		delta := CoverageDelta{Package: name, Before: before[name], After: after[name]}
+		if delta.Before == nil && delta.After == nil {
+			continue
+		}
+
+		var b, a float64
+		if delta.Before != nil {
+			b = roundCoverage(*delta.Before)
+		}
+		if delta.After != nil {
+			a = roundCoverage(*delta.After)
+		}
+		delta.Change = a - b
+
+		if delta.Change == 0 && (delta.Before == nil) == (delta.After == nil) {
+			continue
+		}
+		deltas = append(deltas, delta)
+	}
+
+	sort.SliceStable(deltas, func(i, j int) bool {
+		return math.Abs(deltas[i].Change) > math.Abs(deltas[j].Change)
+	})
+
+	return deltas
+}
+
+// roundCoverage rounds a coverage percentage to the 2 decimals shown in the output
+func roundCoverage(val float64) float64 {
+	return math.Round(val*100) / 100
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSummary(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "coverage.out")
+	err := os.WriteFile(profile, []byte("mode: set\nmod/one/a.go:3.20,5.2 2 1\nmod/one/b.go:7.10,7.30 1 0\n"), 0o666)
+	assert.NoError(t, err)
+
+	result := RunResult{
+		Packages: []PackageResult{
+			{Name: "mod/one", Status: "pass", Elapsed: 0.1, Coverage: "66.7%"},
+			{Name: "mod/two", Status: "pass", Coverage: "10.0%"},
+			{Name: "mod/three", Status: "skip", NoTests: true},
+		},
+		Tests: []TestResult{
+			{Package: "mod/one", Name: "TestFlaky", Status: "fail", Output: []string{"    a_test.go:3: oops"}},
+			{Package: "mod/one", Name: "TestFlaky", Status: "pass"},
+			{Package: "mod/one", Name: "TestSkip", Status: "skip", Output: []string{"    a_test.go:9: later"}},
+			{Package: "mod/two", Name: "TestGood", Status: "pass", Elapsed: 0.2},
+		},
+		BelowCoverage:    []string{"mod/two 10.0% < 50.0%"},
+		NoTestsPackages:  []string{"mod/three"},
+		TotalCoverage:    66.67,
+		CoverageAccurate: true,
+	}
+
+	summary := buildSummary(result, "v1.2.3", "mod", profile)
+
+	one, two := 66.7, 10.0
+	assert.Equal(t, Summary{
+		Version: "v1.2.3",
+		Module:  "mod",
+		Packages: []SummaryPackage{
+			{Name: "mod/one", Status: "pass", Coverage: &one, Statements: 3, Elapsed: 0.1},
+			{Name: "mod/two", Status: "pass", Coverage: &two, Cached: true},
+			{Name: "mod/three", Status: "notests"},
+		},
+		FailedTests:      []SummaryTest{{Package: "mod/one", Name: "TestFlaky", Output: []string{"    a_test.go:3: oops"}}},
+		SkippedTests:     []SummaryTest{{Package: "mod/one", Name: "TestSkip", Output: []string{"    a_test.go:9: later"}}},
+		FlakyTests:       []SummaryTest{{Package: "mod/one", Name: "TestFlaky", Output: []string{"    a_test.go:3: oops"}}},
+		BelowCoverage:    []string{"mod/two 10.0% < 50.0%"},
+		ExcludedPackages: []string{},
+		NoTestsPackages:  []string{"mod/three"},
+		TotalCoverage:    66.67,
+		CoverageAccurate: true,
+	}, summary)
+
+	data, err := json.Marshal(buildSummary(RunResult{}, "", "", ""))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"version": "", "module": "", "packages": [], "failedTests": [], "skippedTests": [], "flakyTests": [], "belowCoverage": [],
+		"excludedPackages": [], "noTestsPackages": [], "totalCoverage": 0, "coverageAccurate": false
+	}`, string(data))
+}
+
+func TestCoverageDeltas(t *testing.T) {
+	cov := func(val float64) *float64 { return &val }
+
+	baseline := Summary{Packages: []SummaryPackage{
+		{Name: "mod/same", Coverage: cov(50)},
+		{Name: "mod/up", Coverage: cov(40)},
+		{Name: "mod/down", Coverage: cov(90)},
+		{Name: "mod/removed", Coverage: cov(10)},
+		{Name: "mod/notests"},
+	}}
+	summary := Summary{Packages: []SummaryPackage{
+		{Name: "mod/same", Coverage: cov(50.001)},
+		{Name: "mod/up", Coverage: cov(45.5)},
+		{Name: "mod/down", Coverage: cov(60)},
+		{Name: "mod/new", Coverage: cov(0)},
+		{Name: "mod/notests"},
+	}}
+
+	assert.Equal(t, []CoverageDelta{
+		{Package: "mod/down", Before: cov(90), After: cov(60), Change: -30},
+		{Package: "mod/removed", Before: cov(10), Change: -10},
+		{Package: "mod/up", Before: cov(40), After: cov(45.5), Change: 5.5},
+		{Package: "mod/new", After: cov(0), Change: 0},
+	}, coverageDeltas(summary, baseline))
+
+	assert.Equal(t, []CoverageDelta{}, coverageDeltas(Summary{}, Summary{}))
+}
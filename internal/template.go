@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// defaultCommentTemplate renders the pull request comment body
+const defaultCommentTemplate = `{{if .FailedTests -}}
+Test failed. 🙅 
+
+ Failed tests:
+
+|Test name|
+|--------|
+{{range .FailedTests}}|{{.Name}}|
+{{end}}
+{{else if .BelowCoverage -}}
+Packages below their coverage threshold. 📉
+
+{{range .BelowCoverage}}- {{.}}
+{{end}}
+{{else -}}
+All tests are successful. 💪
+
+{{end -}}
+Total coverage is {{printf "%.2f" .TotalCoverage}}%
+{{- with .Baseline}} ({{change $.CoverageChange}} vs baseline)
+
+{{if $.CoverageDeltas -}}
+|Package|Before|After|Change|
+|--------|---:|---:|---:|
+{{range $.CoverageDeltas}}|{{.Package}}|{{coverage .Before}}|{{coverage .After}}|{{change .Change}}|
+{{end -}}
+{{else -}}
+No package coverage changes.
+{{end -}}
+{{end}}`
+
+// templateFuncs are the functions available to the templates, in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(val any) (string, error) {
+		data, err := json.Marshal(val)
+		return string(data), err
+	},
+	"percent": func(val float64) string { return sf("%.2f%%", val) },
+	"deref": func(val *float64) float64 {
+		if val == nil {
+			return 0
+		}
+		return *val
+	},
+	"coverage": func(val *float64) string {
+		if val == nil {
+			return "-"
+		}
+		return sf("%.2f%%", *val)
+	},
+	"change": func(val float64) string {
+		switch {
+		case val > 0:
+			return sf("▲ +%.2f%%", val)
+		case val < 0:
+			return sf("▼ %.2f%%", val)
+		}
+		return "0.00%"
+	},
+}
+
+// templateData is rendered by the templates: the run summary and its comparison to the baseline
+type templateData struct {
+	Summary
+	Baseline       *Summary        // baseline summary (-baseline), nil if not set
+	CoverageChange float64         // total coverage change from the baseline
+	CoverageDeltas []CoverageDelta // packages whose coverage changed, largest change first
+}
+
+// summaryInfo holds the run details that are not part of the 'go test' results, needed to build a Summary
+type summaryInfo struct {
+	version      string
+	module       string
+	coverProfile string
+	baseline     *Summary
+}
+
+func (si summaryInfo) build(result RunResult) Summary {
+	return buildSummary(result, si.version, si.module, si.coverProfile)
+}
+
+// data builds the templates data of the run result
+func (si summaryInfo) data(result RunResult) templateData {
+	data := templateData{Summary: si.build(result), Baseline: si.baseline, CoverageDeltas: []CoverageDelta{}}
+	if si.baseline != nil {
+		data.CoverageChange = roundCoverage(data.TotalCoverage) - roundCoverage(si.baseline.TotalCoverage)
+		data.CoverageDeltas = coverageDeltas(data.Summary, *si.baseline)
+	}
+	return data
+}
+
+// parseTemplate parses a template rendered over the templateData
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// loadTemplate reads and parses the template file at 'filePath'. Returns nil if 'filePath' is empty.
+func loadTemplate(filePath string) (*template.Template, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+
+	text, err := readFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	return parseTemplate(filePath, string(text))
+}
+
+func renderTemplate(tmpl *template.Template, data templateData) (string, error) {
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// commentTemplate renders the pull request comment body, with the default template if none is set
+type commentTemplate struct {
+	tmpl *template.Template
+	info summaryInfo
+}
+
+func (ct commentTemplate) render(result RunResult) (string, error) {
+	tmpl := ct.tmpl
+	if tmpl == nil {
+		var err error
+		tmpl, err = parseTemplate("comment", defaultCommentTemplate)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return renderTemplate(tmpl, ct.info.data(result))
+}
+
+// templateReporter renders the user template once the run is done, to a file or the terminal
+type templateReporter struct {
+	nopReporter
+	tmpl     *template.Template
+	info     summaryInfo
+	filePath string // output file, printed if empty
+	lineOut  func(str ...string)
+}
+
+func (r templateReporter) OnSummary(result RunResult) error {
+	out, err := renderTemplate(r.tmpl, r.info.data(result))
+	if err != nil {
+		return err
+	}
+
+	if r.filePath == "" {
+		r.lineOut(out)
+		return nil
+	}
+
+	err = os.WriteFile(r.filePath, []byte(out), 0o666)
+	if err != nil {
+		return fmt.Errorf("failed to write template output: %w", err)
+	}
+
+	return nil
+}
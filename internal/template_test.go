@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentTemplate(t *testing.T) {
+	t.Run("default success", func(t *testing.T) {
+		body, err := commentTemplate{}.render(RunResult{TotalCoverage: 75})
+		assert.NoError(t, err)
+		assert.Equal(t, "All tests are successful. 💪\n\nTotal coverage is 75.00%", body)
+	})
+
+	t.Run("default failed", func(t *testing.T) {
+		result := RunResult{
+			Tests: []TestResult{
+				{Package: "mod/a", Name: "TestBad", Status: "fail"},
+				{Package: "mod/a", Name: "TestGood", Status: "pass"},
+				{Package: "mod/b", Name: "TestWorse", Status: "fail"},
+			},
+			TotalCoverage: 50.5,
+		}
+
+		body, err := commentTemplate{}.render(result)
+		assert.NoError(t, err)
+		assert.Equal(t, "Test failed. 🙅 \n\n Failed tests:\n\n|Test name|\n|--------|\n|TestBad|\n|TestWorse|\n\nTotal coverage is 50.50%", body)
+	})
+
+	t.Run("default with baseline", func(t *testing.T) {
+		result := RunResult{
+			Packages: []PackageResult{
+				{Name: "mod/a", Status: "pass", Coverage: "80.0%"},
+				{Name: "mod/b", Status: "pass", Coverage: "50.0%"},
+			},
+			TotalCoverage: 65,
+		}
+		a, b := 70.0, 55.5
+		baseline := &Summary{
+			Packages:      []SummaryPackage{{Name: "mod/a", Coverage: &a}, {Name: "mod/b", Coverage: &b}},
+			TotalCoverage: 62.75,
+		}
+
+		body, err := commentTemplate{info: summaryInfo{baseline: baseline}}.render(result)
+		assert.NoError(t, err)
+		assert.Equal(t, "All tests are successful. 💪\n\nTotal coverage is 65.00% (▲ +2.25% vs baseline)\n\n"+
+			"|Package|Before|After|Change|\n|--------|---:|---:|---:|\n"+
+			"|mod/a|70.00%|80.00%|▲ +10.00%|\n"+
+			"|mod/b|55.50%|50.00%|▼ -5.50%|\n", body)
+
+		result.Packages[0].Coverage, result.Packages[1].Coverage = "70.0%", "55.5%"
+		result.TotalCoverage = 62.75
+		body, err = commentTemplate{info: summaryInfo{baseline: baseline}}.render(result)
+		assert.NoError(t, err)
+		assert.Equal(t, "All tests are successful. 💪\n\nTotal coverage is 62.75% (0.00% vs baseline)\n\nNo package coverage changes.\n", body)
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		tmpl, err := parseTemplate("comment", "{{.Module}} {{percent .TotalCoverage}}")
+		assert.NoError(t, err)
+
+		body, err := commentTemplate{tmpl: tmpl, info: summaryInfo{module: "mod"}}.render(RunResult{TotalCoverage: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, "mod 10.00%", body)
+	})
+}
+
+func TestLoadTemplate(t *testing.T) {
+	dir := t.TempDir()
+
+	tmpl, err := loadTemplate("")
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	_, err = loadTemplate(filepath.Join(dir, "missing.tmpl"))
+	assert.ErrorContains(t, err, "failed to read template")
+
+	invalid := filepath.Join(dir, "invalid.tmpl")
+	assert.NoError(t, os.WriteFile(invalid, []byte("{{.Packages"), 0o666))
+	_, err = loadTemplate(invalid)
+	assert.ErrorContains(t, err, "failed to parse template")
+
+	unknown := filepath.Join(dir, "unknown.tmpl")
+	assert.NoError(t, os.WriteFile(unknown, []byte("{{.Nope}}"), 0o666))
+	tmpl, err = loadTemplate(unknown)
+	assert.NoError(t, err)
+	_, err = renderTemplate(tmpl, templateData{})
+	assert.ErrorContains(t, err, "failed to render template")
+}
+
+func TestTemplateReporter(t *testing.T) {
+	text := `{{range .Packages}}{{.Name}} {{.Status}} {{percent (deref .Coverage)}}
+{{end}}{{join .NoTestsPackages ","}}`
+	tmpl, err := parseTemplate("user", text)
+	assert.NoError(t, err)
+
+	result := RunResult{
+		Packages: []PackageResult{
+			{Name: "mod/a", Status: "pass", Coverage: "80.0%"},
+			{Name: "mod/b", Status: "skip", NoTests: true},
+		},
+		NoTestsPackages: []string{"mod/b"},
+	}
+	expected := "mod/a pass 80.00%\nmod/b notests 0.00%\nmod/b"
+
+	printed := []string{}
+	r := templateReporter{tmpl: tmpl, lineOut: func(str ...string) { printed = append(printed, str...) }}
+	assert.NoError(t, r.OnSummary(result))
+	assert.Equal(t, []string{expected}, printed)
+
+	r.filePath = filepath.Join(t.TempDir(), "out.txt")
+	assert.NoError(t, r.OnSummary(result))
+	data, err := os.ReadFile(r.filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+}